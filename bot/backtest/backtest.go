@@ -0,0 +1,97 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	// not-std
+	"bot/domain"
+	"bot/service"
+	"bot/simulator"
+)
+
+// Report summarizes the result of a backtest. P&L is measured in quote
+// currency per contract, open positions are marked at the closing side of the book.
+type Report struct {
+	Tickers     int
+	Trades      int // orders filled at least partially
+	Volume      int64
+	RealizedPnL float64
+	PnL         float64
+	MaxDrawdown float64
+	Exposure    float64 // share of tickers with an open position
+	AvgPosition float64 // average absolute position size
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf(`tickers:      %d
+trades:       %d
+volume:       %d
+realized pnl: %.2f
+total pnl:    %.2f
+max drawdown: %.2f
+exposure:     %.2f%%
+avg position: %.2f`,
+		r.Tickers, r.Trades, r.Volume, r.RealizedPnL, r.PnL,
+		r.MaxDrawdown, r.Exposure*100, r.AvgPosition)
+}
+
+// Run replays the tape through service.Bot with the given models and parameters,
+// filling orders on a simulated exchange. models overrides the default model per instrument.
+func Run(tape []domain.Ticker, model service.Predictor, models map[string]service.Predictor,
+	params service.Parameters) (*Report, error) {
+	exchange := simulator.New()
+	bot := service.New(exchange, discardNotifier{}, discardStorage{}, model, params)
+	for instrument, m := range models {
+		bot.SetModel(instrument, m)
+	}
+	exchange.SetFillHandler(bot.OnFills)
+	report := &Report{}
+	var peak, exposed float64
+	var positions int64
+	onTicker := func(ticker domain.Ticker) {
+		exchange.SetQuote(ticker)
+		realized, unrealized := exchange.PnL()
+		equity := realized + unrealized
+		peak = math.Max(peak, equity)
+		report.MaxDrawdown = math.Max(report.MaxDrawdown, peak-equity)
+		if exposure := exchange.Exposure(); exposure != 0 {
+			exposed++
+			positions += exposure
+		}
+		report.Tickers++
+	}
+	if err := bot.Replay(context.Background(), tape, onTicker); err != nil {
+		return nil, err
+	}
+	orders := make(map[string]bool)
+	for _, fill := range exchange.Fills() {
+		if !orders[fill.OrderID] {
+			orders[fill.OrderID] = true
+			report.Trades++
+		}
+		report.Volume += fill.Amount
+	}
+	realized, unrealized := exchange.PnL()
+	report.RealizedPnL = realized
+	report.PnL = realized + unrealized
+	if report.Tickers > 0 {
+		report.Exposure = exposed / float64(report.Tickers)
+		report.AvgPosition = float64(positions) / float64(report.Tickers)
+	}
+	return report, nil
+}
+
+type discardNotifier struct{}
+
+func (discardNotifier) Start() error             { return nil }
+func (discardNotifier) Notify(text string) error { return nil }
+func (discardNotifier) Stop()                    {}
+
+type discardStorage struct{}
+
+func (discardStorage) StoreEvent(ctx context.Context, record domain.EventRecord) error { return nil }
+func (discardStorage) StoreVeto(ctx context.Context, veto domain.RiskVeto) error       { return nil }
+func (discardStorage) StorePrediction(ctx context.Context, record domain.PredictionRecord) error {
+	return nil
+}
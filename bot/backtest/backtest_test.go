@@ -0,0 +1,49 @@
+package backtest
+
+import (
+	"bot/domain"
+	"bot/service"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// tapeModel predicts by the time of the last ticker, neutral if not set
+type tapeModel map[int64]float64
+
+func (m tapeModel) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	if value, ok := m[tickers[len(tickers)-1].Time]; ok {
+		return value, nil
+	}
+	return 0.5, nil
+}
+
+func TestRun(t *testing.T) {
+	tape := []domain.Ticker{
+		{ProductId: "PI_XBTUSD", Time: 1000, Bid: 99, Ask: 101},
+		{ProductId: "PI_XBTUSD", Time: 2000, Bid: 95, Ask: 97},
+		{ProductId: "PI_XBTUSD", Time: 3000, Bid: 105, Ask: 107},
+		{ProductId: "PI_XBTUSD", Time: 4000, Bid: 104, Ask: 106},
+	}
+	// buy 2 at 101, hold through 95, sell 2 at 105
+	model := tapeModel{1000: 0.9, 3000: 0.1}
+	params := service.Parameters{InstrumentParameters: service.InstrumentParameters{
+		Instrument:        "PI_XBTUSD",
+		MaxPositionSize:   10,
+		OrderSize:         2,
+		DecisionThreshold: 0.6,
+		SequenceLength:    1,
+		PriceSlipPercent:  1,
+	}}
+	report, err := Run(tape, model, nil, params)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.Tickers)
+	assert.Equal(t, 2, report.Trades)
+	assert.Equal(t, int64(4), report.Volume)
+	assert.InDelta(t, 8, report.RealizedPnL, 1e-9)
+	assert.InDelta(t, 8, report.PnL, 1e-9)
+	// marked at the bid of 95: 2 * (95 - 101)
+	assert.InDelta(t, 12, report.MaxDrawdown, 1e-9)
+	assert.InDelta(t, 0.5, report.Exposure, 1e-9)
+	assert.InDelta(t, 1, report.AvgPosition, 1e-9)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/modelapi"
+	"bot/recorder"
+	"bot/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// record is a line of the dataset: the model input of a sequence and the move of the mid price after it
+type record struct {
+	Instrument string      `json:"instrument"`
+	Time       int64       `json:"time"` // of the last ticker, ms
+	Features   [][]float64 `json:"features"`
+	Return     float64     `json:"return"` // log return of the mid price over the horizon
+	Label      int         `json:"label"`  // 1 if the mid price went up
+}
+
+// Exports recorded tickers as a training dataset in JSON lines: the sequences are cut
+// and transformed by the same code as in trading, so training and serving don't drift apart
+func main() {
+	tapePath := flag.String("tape_path", "", "path to recorded tickers file or directory")
+	modelConfigPath := flag.String("model_config_path", "", "path to model config with the features")
+	botConfigPath := flag.String("bot_config_path", "", "path to yaml file with bot parameters (instruments, sequence_length)")
+	horizon := flag.Duration("horizon", time.Minute, "label: move of the mid price after the sequence")
+	out := flag.String("out", "", "output file, stdout if empty")
+	flag.Parse()
+
+	tape, err := recorder.ReadPath(*tapePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(*modelConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelConfig, err := modelapi.ParseConfig(string(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pipeline, err := modelConfig.Pipeline()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err = os.ReadFile(*botConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var params service.Parameters
+	if err := yaml.Unmarshal(data, &params); err != nil {
+		log.Fatal(err)
+	}
+	if err := params.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	log.Info("features: ", pipeline.Names())
+
+	// tickers per instrument for the labels
+	byInstrument := make(map[string][]domain.Ticker)
+	for _, ticker := range tape {
+		byInstrument[ticker.ProductId] = append(byInstrument[ticker.ProductId], ticker)
+	}
+	var count int
+	for _, seq := range service.Sequences(tape, params.InstrumentList()) {
+		last := seq[len(seq)-1]
+		future, ok := after(byInstrument[last.ProductId], last.Time+horizon.Milliseconds())
+		if !ok {
+			continue
+		}
+		r := record{
+			Instrument: last.ProductId,
+			Time:       last.Time,
+			Features:   pipeline.Transform(seq),
+		}
+		if mid, next := (last.Bid+last.Ask)/2, (future.Bid+future.Ask)/2; mid > 0 && next > 0 {
+			r.Return = math.Log(next / mid)
+		}
+		if r.Return > 0 {
+			r.Label = 1
+		}
+		if err := encoder.Encode(r); err != nil {
+			log.Fatal(err)
+		}
+		count++
+	}
+	if err := buf.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("%d sequences exported", count)
+}
+
+// after returns the first ticker at or after the time, tickers are in time order
+func after(tickers []domain.Ticker, time int64) (domain.Ticker, bool) {
+	i := sort.Search(len(tickers), func(i int) bool { return tickers[i].Time >= time })
+	if i == len(tickers) {
+		return domain.Ticker{}, false
+	}
+	return tickers[i], true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/krakenapi"
+	"bot/krakensim"
+	"bot/recorder"
+	"bot/simulator"
+	"github.com/go-chi/chi/v5/middleware"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Local Kraken Futures simulator. Point the bot at it with
+// rest_url: http://localhost:3001/derivatives and websocket_url: ws://localhost:3001/ws/v1
+func main() {
+	addr := flag.String("addr", ":3001", "listen address")
+	krakenConfigPath := flag.String("kraken_config_path", "", "path to yaml file with kraken config (keys are used to verify requests)")
+	tapePath := flag.String("tape_path", "", "path to recorded tickers file or directory, random walk if empty")
+	speed := flag.Float64("speed", 0, "tape playback speed, 1 is the original timing, 0 uses interval")
+	product := flag.String("product", "PI_XBTUSD", "product id for random walk tickers")
+	interval := flag.Duration("interval", time.Second, "delay between tickers")
+	flag.Parse()
+
+	var config krakenapi.Config
+	if *krakenConfigPath != "" {
+		data, err := os.ReadFile(*krakenConfigPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			log.Fatal(err)
+		}
+	}
+	server := krakensim.New(simulator.New(), config.PublicKey, config.PrivateKey)
+
+	next := randomWalk(*product)
+	if *tapePath != "" {
+		tape, err := recorder.ReadPath(*tapePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(tape) == 0 {
+			log.Fatal("empty tape")
+		}
+		next = loop(tape)
+		if *speed > 0 {
+			go func() {
+				for {
+					for ticker := range recorder.Play(context.Background(), tape, *speed) {
+						ticker.Time = time.Now().UnixNano() / int64(time.Millisecond)
+						server.Broadcast(ticker)
+					}
+				}
+			}()
+		}
+	}
+	if *tapePath == "" || *speed <= 0 {
+		go func() {
+			for range time.Tick(*interval) {
+				server.Broadcast(next())
+			}
+		}()
+	}
+
+	r := server.Routes()
+	log.Info("kraken simulator listening on ", *addr)
+	log.Fatal(http.ListenAndServe(*addr, middleware.Logger(r)))
+}
+
+func loop(tape []domain.Ticker) func() domain.Ticker {
+	i := 0
+	return func() domain.Ticker {
+		ticker := tape[i%len(tape)]
+		ticker.Time = time.Now().UnixNano() / int64(time.Millisecond)
+		i++
+		return ticker
+	}
+}
+
+func randomWalk(product string) func() domain.Ticker {
+	price := 50000.0
+	return func() domain.Ticker {
+		price *= 1 + rand.NormFloat64()*0.0005
+		spread := price * 0.0002
+		return domain.Ticker{
+			Time:      time.Now().UnixNano() / int64(time.Millisecond),
+			Feed:      "ticker",
+			ProductId: product,
+			Bid:       price - spread/2,
+			Ask:       price + spread/2,
+			BidSize:   float64(rand.Intn(50000)),
+			AskSize:   float64(rand.Intn(50000)),
+			Last:      price,
+			Leverage:  "50x",
+		}
+	}
+}
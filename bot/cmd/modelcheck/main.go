@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math"
+	"os"
+	"time"
+	// not-std
+	"bot/modelapi"
+	"bot/recorder"
+	"bot/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Compares the in-process model with TF Serving on the sequences of recorded tickers:
+// the model config with the features and the served model is the reference,
+// model_path is the file exported from the same model by export_weights.py
+func main() {
+	tapePath := flag.String("tape_path", "", "path to recorded tickers file or directory")
+	modelConfigPath := flag.String("model_config_path", "", "path to model config of the served model")
+	modelPath := flag.String("model_path", "", "path to exported model weights")
+	botConfigPath := flag.String("bot_config_path", "", "path to yaml file with bot parameters (instruments, sequence_length)")
+	maxError := flag.Float64("max_error", modelapi.DefaultMaxError, "largest allowed difference of the predictions")
+	limit := flag.Int("limit", 1000, "sequences to compare, all if 0")
+	flag.Parse()
+
+	tape, err := recorder.ReadPath(*tapePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(*modelConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	served, err := modelapi.NewFromConfig(string(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelConfig, err := modelapi.ParseConfig(string(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pipeline, err := modelConfig.Pipeline()
+	if err != nil {
+		log.Fatal(err)
+	}
+	local, err := modelapi.NewLocal(*modelPath, *maxError, pipeline)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err = os.ReadFile(*botConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var params service.Parameters
+	if err := yaml.Unmarshal(data, &params); err != nil {
+		log.Fatal(err)
+	}
+	if err := params.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	var count, failed int
+	var maxDiff, sumDiff float64
+	var localTime, servedTime time.Duration
+	for _, seq := range service.Sequences(tape, params.InstrumentList()) {
+		if *limit > 0 && count == *limit {
+			break
+		}
+		start := time.Now()
+		want, err := served.Predict(context.Background(), seq...)
+		servedTime += time.Since(start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		start = time.Now()
+		got, err := local.Predict(context.Background(), seq...)
+		localTime += time.Since(start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		diff := math.Abs(got - want)
+		if diff > *maxError {
+			failed++
+			log.Warningf("%s at %d: served %g, local %g", seq[len(seq)-1].ProductId, seq[len(seq)-1].Time, want, got)
+		}
+		maxDiff = math.Max(maxDiff, diff)
+		sumDiff += diff
+		count++
+	}
+	if count == 0 {
+		log.Fatal("no sequences in the tape")
+	}
+	log.Infof("%d sequences: max error %g, mean error %g, served %v, local %v per prediction",
+		count, maxDiff, sumDiff/float64(count), servedTime/time.Duration(count), localTime/time.Duration(count))
+	if failed > 0 {
+		log.Fatalf("%d predictions differ by more than %g", failed, *maxError)
+	}
+}
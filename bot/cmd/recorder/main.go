@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	// not-std
+	"bot/krakenapi"
+	"bot/recorder"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Records the Kraken ticker feed to rotating compressed files until SIGINT/SIGTERM
+func main() {
+	krakenConfigPath := flag.String("kraken_config_path", "", "path to yaml file with kraken config")
+	instruments := flag.String("instruments", "PI_XBTUSD", "comma separated product ids")
+	var config recorder.Config
+	flag.StringVar(&config.Dir, "dir", "tickers", "output directory")
+	flag.StringVar(&config.Format, "format", recorder.JSONL, "file format: jsonl or csv")
+	flag.DurationVar(&config.RotateInterval, "rotate_interval", recorder.DefaultRotateInterval, "start a new file after the interval")
+	flag.Int64Var(&config.RotateSize, "rotate_size", recorder.DefaultRotateSize, "start a new file after the number of uncompressed bytes")
+	flag.Parse()
+
+	var krakenConfig krakenapi.Config
+	if *krakenConfigPath != "" {
+		data, err := os.ReadFile(*krakenConfigPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := yaml.Unmarshal(data, &krakenConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	rec, err := recorder.New(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api := krakenapi.NewWithConfig(krakenConfig)
+	tickers, err := api.Subscribe(strings.Split(*instruments, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		if err := api.Unsubscribe(); err != nil {
+			log.Error(err)
+		}
+	}()
+	log.Info("recording to ", config.Dir)
+	var count int
+	for ticker := range tickers {
+		if err := rec.Write(ticker); err != nil {
+			log.Error(err)
+		}
+		count++
+	}
+	if err := rec.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Info("recorded tickers: ", count)
+}
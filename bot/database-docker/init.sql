@@ -1,8 +1,53 @@
-create table orders(symbol text,
+create table orders(id bigserial primary key,
+                    decision_id text,
+                    order_id text,
+                    status text,
+                    event_type text,
+                    execution_id text,
+                    reason text,
+                    symbol text,
                     side text,
                     type text,
                     order_price numeric,
                     order_size numeric,
                     actual_price numeric,
                     actual_amount numeric,
-                    timestamp timestamp);
\ No newline at end of file
+                    timestamp timestamp,
+                    paper boolean not null default false,
+                    trigger text);
+
+create index orders_order_id_idx on orders(order_id);
+create index orders_decision_id_idx on orders(decision_id);
+
+create table risk_vetoes(id bigserial primary key,
+                         decision_id text,
+                         risk_check text,
+                         reason text,
+                         symbol text,
+                         side text,
+                         type text,
+                         order_price numeric,
+                         order_size numeric,
+                         allowed_size numeric,
+                         timestamp timestamp,
+                         paper boolean not null default false);
+
+create table predictions(id bigserial primary key,
+                         decision_id text not null,
+                         symbol text,
+                         strategy text,
+                         model text,
+                         value double precision,
+                         threshold double precision,
+                         action text,
+                         size numeric,
+                         price numeric,
+                         error text,
+                         sequence_hash text,
+                         sequence_from bigint,
+                         sequence_to bigint,
+                         tickers jsonb,
+                         timestamp timestamp,
+                         paper boolean not null default false);
+
+create index predictions_decision_id_idx on predictions(decision_id);
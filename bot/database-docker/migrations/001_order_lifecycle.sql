@@ -0,0 +1,13 @@
+-- upgrade of an existing orders table to the order lifecycle schema
+alter table orders add column id bigserial primary key,
+                   add column decision_id text,
+                   add column order_id text,
+                   add column status text,
+                   add column event_type text,
+                   add column execution_id text,
+                   add column reason text;
+
+update orders set event_type = 'EXECUTION', status = 'placed' where event_type is null;
+
+create index orders_order_id_idx on orders(order_id);
+create index orders_decision_id_idx on orders(decision_id);
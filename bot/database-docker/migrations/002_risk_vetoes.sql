@@ -0,0 +1,11 @@
+create table risk_vetoes(id bigserial primary key,
+                         decision_id text,
+                         risk_check text,
+                         reason text,
+                         symbol text,
+                         side text,
+                         type text,
+                         order_price numeric,
+                         order_size numeric,
+                         allowed_size numeric,
+                         timestamp timestamp);
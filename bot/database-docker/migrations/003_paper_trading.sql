@@ -0,0 +1,2 @@
+alter table orders add column paper boolean not null default false;
+alter table risk_vetoes add column paper boolean not null default false;
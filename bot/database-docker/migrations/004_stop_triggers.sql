@@ -0,0 +1 @@
+alter table orders add column trigger text;
@@ -0,0 +1,19 @@
+create table predictions(id bigserial primary key,
+                         decision_id text not null,
+                         symbol text,
+                         strategy text,
+                         model text,
+                         value double precision,
+                         threshold double precision,
+                         action text,
+                         size numeric,
+                         price numeric,
+                         error text,
+                         sequence_hash text,
+                         sequence_from bigint,
+                         sequence_to bigint,
+                         tickers jsonb,
+                         timestamp timestamp,
+                         paper boolean not null default false);
+
+create index predictions_decision_id_idx on predictions(decision_id);
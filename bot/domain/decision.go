@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// Decision is an action chosen by the bot for the instrument
+type Decision struct {
+	ID     string
+	Symbol string
+	Action Action
+	Size   int64
+	Price  float64
+	TS     time.Time
+	// Trigger is the exit trigger of a stop decision, empty for model decisions
+	Trigger string
+}
+
+func NewDecision(symbol string, action Action, size int64, price float64) *Decision {
+	return &Decision{
+		ID:     NewID(),
+		Symbol: symbol,
+		Action: action,
+		Size:   size,
+		Price:  price,
+		TS:     time.Now(),
+	}
+}
+
+// NewID returns a random uuid (version 4)
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
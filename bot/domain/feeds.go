@@ -0,0 +1,133 @@
+package domain
+
+// Feeds
+const (
+	TickerFeed             = "ticker"
+	BookFeed               = "book"
+	BookSnapshotFeed       = "book_snapshot"
+	TradeFeed              = "trade"
+	TradeSnapshotFeed      = "trade_snapshot"
+	FillsFeed              = "fills"
+	FillsSnapshotFeed      = "fills_snapshot"
+	OpenOrdersFeed         = "open_orders"
+	OpenOrdersSnapshotFeed = "open_orders_snapshot"
+	OpenPositionsFeed      = "open_positions"
+	HeartbeatFeed          = "heartbeat"
+)
+
+// PrivateFeeds require the challenge/sign authentication
+var PrivateFeeds = map[string]bool{
+	FillsFeed:         true,
+	OpenOrdersFeed:    true,
+	OpenPositionsFeed: true,
+}
+
+type BookLevel struct {
+	Price float64 `json:"price"`
+	Qty   float64 `json:"qty"`
+}
+
+type BookSnapshot struct {
+	Feed      string      `json:"feed"`
+	ProductId string      `json:"product_id"`
+	Timestamp int64       `json:"timestamp"`
+	Seq       int64       `json:"seq"`
+	Bids      []BookLevel `json:"bids"`
+	Asks      []BookLevel `json:"asks"`
+}
+
+// BookUpdate sets the quantity of the price level, 0 removes the level
+type BookUpdate struct {
+	Feed      string  `json:"feed"`
+	ProductId string  `json:"product_id"`
+	Side      string  `json:"side"` // buy or sell
+	Seq       int64   `json:"seq"`
+	Price     float64 `json:"price"`
+	Qty       float64 `json:"qty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type Trade struct {
+	Feed      string  `json:"feed"`
+	ProductId string  `json:"product_id"`
+	UID       string  `json:"uid"`
+	Side      string  `json:"side"`
+	Type      string  `json:"type"`
+	Seq       int64   `json:"seq"`
+	Time      int64   `json:"time"`
+	Qty       float64 `json:"qty"`
+	Price     float64 `json:"price"`
+}
+
+type TradeSnapshot struct {
+	Feed      string  `json:"feed"`
+	ProductId string  `json:"product_id"`
+	Trades    []Trade `json:"trades"`
+}
+
+// Fill is an execution of an own order
+type Fill struct {
+	Instrument string  `json:"instrument"`
+	Time       int64   `json:"time"`
+	Price      float64 `json:"price"`
+	Seq        int64   `json:"seq"`
+	Buy        bool    `json:"buy"`
+	Qty        float64 `json:"qty"`
+	OrderID    string  `json:"order_id"`
+	CliOrdID   string  `json:"cli_ord_id,omitempty"`
+	FillID     string  `json:"fill_id"`
+	FillType   string  `json:"fill_type"`
+}
+
+// Fills is a snapshot or an update of the fills feed
+type Fills struct {
+	Feed    string `json:"feed"`
+	Account string `json:"account,omitempty"`
+	Fills   []Fill `json:"fills"`
+}
+
+type OpenOrder struct {
+	Instrument     string  `json:"instrument"`
+	Time           int64   `json:"time"`
+	LastUpdateTime int64   `json:"last_update_time"`
+	Qty            float64 `json:"qty"`
+	Filled         float64 `json:"filled"`
+	LimitPrice     float64 `json:"limit_price"`
+	StopPrice      float64 `json:"stop_price"`
+	Type           string  `json:"type"`
+	OrderID        string  `json:"order_id"`
+	CliOrdID       string  `json:"cli_ord_id,omitempty"`
+	Direction      int     `json:"direction"` // 0 buy, 1 sell
+	ReduceOnly     bool    `json:"reduce_only"`
+}
+
+type OpenOrdersSnapshot struct {
+	Feed    string      `json:"feed"`
+	Account string      `json:"account"`
+	Orders  []OpenOrder `json:"orders"`
+}
+
+// OpenOrderUpdate is a new, changed or canceled order. Order is nil if only
+// the id of the removed order is known.
+type OpenOrderUpdate struct {
+	Feed     string     `json:"feed"`
+	Order    *OpenOrder `json:"order,omitempty"`
+	OrderID  string     `json:"order_id,omitempty"`
+	IsCancel bool       `json:"is_cancel"`
+	Reason   string     `json:"reason"`
+}
+
+type OpenPosition struct {
+	Instrument string  `json:"instrument"`
+	Balance    float64 `json:"balance"` // signed size
+	EntryPrice float64 `json:"entry_price"`
+	MarkPrice  float64 `json:"mark_price"`
+	IndexPrice float64 `json:"index_price"`
+	PnL        float64 `json:"pnl"`
+}
+
+type OpenPositions struct {
+	Feed      string         `json:"feed"`
+	Account   string         `json:"account"`
+	Positions []OpenPosition `json:"positions"`
+}
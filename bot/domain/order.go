@@ -6,9 +6,10 @@ type OrderType string
 
 // Order Types
 const (
-	LmtType OrderType = "lmt"
-	IocType OrderType = "ioc"
-	MktType OrderType = "mkt"
+	LmtType  OrderType = "lmt"
+	IocType  OrderType = "ioc"
+	MktType  OrderType = "mkt"
+	PostType OrderType = "post" // post-only limit order, rejected if it would take liquidity
 )
 
 type Action string
@@ -20,12 +21,57 @@ const (
 	None Action = "none"
 )
 
+// Order event types
+const (
+	ExecutionEvent = "EXECUTION"
+	CancelEvent    = "CANCEL"
+	RejectEvent    = "REJECT"
+	PlaceEvent     = "PLACE"
+)
+
+// Exit triggers of open positions
+const (
+	StopLossTrigger     = "stop_loss"
+	TakeProfitTrigger   = "take_profit"
+	TrailingStopTrigger = "trailing_stop"
+)
+
 type OrderEvent struct {
-	Type      string  `json:"type"`
-	Price     float64 `json:"price,omitempty"`  // execution price
-	Amount    int64   `json:"amount,omitempty"` // execution quantity
-	ExecOrder *Order  `json:"orderPriorExecution,omitempty"`
-	Order     *Order  `json:"order,omitempty"`
+	Type        string  `json:"type"`
+	ExecutionID string  `json:"executionId,omitempty"`
+	Price       float64 `json:"price,omitempty"`  // execution price
+	Amount      int64   `json:"amount,omitempty"` // execution quantity
+	Reason      string  `json:"reason,omitempty"` // reject reason
+	ExecOrder   *Order  `json:"orderPriorExecution,omitempty"`
+	Order       *Order  `json:"order,omitempty"`
+}
+
+// OrderInfo returns the order the event refers to
+func (e *OrderEvent) OrderInfo() *Order {
+	if e.ExecOrder != nil {
+		return e.ExecOrder
+	}
+	return e.Order
+}
+
+// EventRecord is an order event together with the response status
+// and the decision that caused the order
+type EventRecord struct {
+	DecisionID string `json:"decision_id"`
+	OrderID    string `json:"order_id"`
+	Status     string `json:"status"`
+	Trigger    string `json:"trigger,omitempty"` // exit trigger, empty for model decisions
+	OrderEvent
+}
+
+// OrderFilter selects stored order events, zero fields are not applied
+type OrderFilter struct {
+	Symbol string
+	Side   Action
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
 }
 
 type Order struct {
@@ -0,0 +1,58 @@
+package domain
+
+// CostBasis is a position with average entry price
+type CostBasis struct {
+	Size  int64   // signed: > 0 long, < 0 short
+	Price float64 // average entry price
+}
+
+// Apply adds a fill of signed size delta at price to the position
+// and returns realized P&L of the closed part
+func (c *CostBasis) Apply(delta int64, price float64) float64 {
+	if delta == 0 {
+		return 0
+	}
+	if c.Size == 0 || (c.Size > 0) == (delta > 0) {
+		// open or increase: update average entry price
+		total := c.Size + delta
+		c.Price = (c.Price*float64(abs(c.Size)) + price*float64(abs(delta))) / float64(abs(total))
+		c.Size = total
+		return 0
+	}
+	// reduce, close or flip
+	closed := Min(abs(delta), abs(c.Size))
+	realized := float64(closed) * (price - c.Price)
+	if c.Size < 0 {
+		realized = -realized
+	}
+	c.Size += delta
+	switch {
+	case c.Size == 0:
+		c.Price = 0
+	case (c.Size > 0) == (delta > 0):
+		c.Price = price
+	}
+	return realized
+}
+
+// Position returns the cost basis as an open position
+func (c *CostBasis) Position(symbol string) Position {
+	side := "long"
+	if c.Size < 0 {
+		side = "short"
+	}
+	return Position{Side: side, Symbol: symbol, Price: c.Price, Size: abs(c.Size)}
+}
+
+// DailyPnL is realized P&L of the instrument for a day
+type DailyPnL struct {
+	Day         string  `json:"day"`
+	Symbol      string  `json:"symbol"`
+	RealizedPnL float64 `json:"realized_pnl"`
+	Volume      int64   `json:"volume"`
+	Trades      int     `json:"trades"`
+}
+
+func abs(x int64) int64 {
+	return Max(x, -x)
+}
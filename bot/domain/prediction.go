@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// PredictionRecord is the audit record of a decision of the strategy:
+// what it saw, what it predicted and the order sent on it
+type PredictionRecord struct {
+	DecisionID string  `json:"decision_id"`
+	Symbol     string  `json:"symbol"`
+	Strategy   string  `json:"strategy"`
+	Model      string  `json:"model,omitempty"` // source of the prediction, if reported by the model
+	Value      float64 `json:"value"`
+	Threshold  float64 `json:"threshold"` // the value is compared with
+	Action     Action  `json:"action"`
+	Size       int64   `json:"size"`
+	Price      float64 `json:"price"`
+	OrderID    string  `json:"order_id,omitempty"` // of the order sent on the decision
+	Error      string  `json:"error,omitempty"`    // of the strategy or sending the order
+	// the sequence and where to find it in the recorded tape
+	SequenceHash string    `json:"sequence_hash"`
+	SequenceFrom int64     `json:"sequence_from"` // time of the first ticker, ms
+	SequenceTo   int64     `json:"sequence_to"`   // time of the last ticker, ms
+	Tickers      []Ticker  `json:"tickers,omitempty"`
+	TS           time.Time `json:"timestamp"`
+}
+
+// SequenceHash returns the sha256 of the tickers in JSON
+func SequenceHash(tickers []Ticker) string {
+	data, _ := json.Marshal(tickers)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
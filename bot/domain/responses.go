@@ -29,6 +29,8 @@ type OpenPositionsResponse struct {
 }
 
 type Status struct {
-	Status      string       `json:"status"`
-	OrderEvents []OrderEvent `json:"orderEvents"`
+	OrderID      string       `json:"order_id,omitempty"`
+	Status       string       `json:"status"`
+	ReceivedTime string       `json:"receivedTime,omitempty"`
+	OrderEvents  []OrderEvent `json:"orderEvents"`
 }
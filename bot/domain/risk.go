@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// RiskVeto is an order rejected or reduced by a risk check before sending
+type RiskVeto struct {
+	DecisionID  string    `json:"decision_id"`
+	Check       string    `json:"check"`
+	Reason      string    `json:"reason"`
+	Order       Order     `json:"order"`        // requested order
+	AllowedSize int64     `json:"allowed_size"` // 0 if the order is vetoed
+	TS          time.Time `json:"timestamp"`
+}
@@ -1,7 +1,29 @@
 package domain
 
+import "time"
+
 type Message struct {
 	Event      string   `json:"event"`
 	Feed       string   `json:"feed"`
-	ProductIDs []string `json:"product_ids"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+	// private feeds
+	APIKey            string `json:"api_key,omitempty"`
+	OriginalChallenge string `json:"original_challenge,omitempty"`
+	SignedChallenge   string `json:"signed_challenge,omitempty"`
+}
+
+// Connection states of a feed
+const (
+	Connected    = "connected"
+	Reconnecting = "reconnecting"
+	Disconnected = "disconnected" // reconnection failed
+	Closed       = "closed"
+)
+
+// ConnectionEvent is a change of the feed connection state
+type ConnectionEvent struct {
+	Time  time.Time `json:"time"`
+	Feeds string    `json:"feeds"`
+	State string    `json:"state"`
+	Error string    `json:"error,omitempty"`
 }
@@ -0,0 +1,224 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// Feature kinds
+const (
+	Field     = "field"       // value of the ticker field
+	Return    = "return"      // log return of the field from the previous ticker
+	LogSpread = "log_spread"  // log(ask / bid)
+	ZScore    = "zscore"      // z-score of the field over the window
+	Imbalance = "imbalance"   // (bid_size - ask_size) / (bid_size + ask_size)
+	TimeOfDay = "time_of_day" // sin and cos of the UTC time of day, two columns
+)
+
+var ErrInvalidFeature = errors.New("invalid feature")
+
+// Feature is a column (two for time_of_day) of the model input
+type Feature struct {
+	Name   string `yaml:"name" json:"name"`
+	Field  string `yaml:"field" json:"field,omitempty"`   // field, return and zscore: ticker field, mid if empty
+	Window int    `yaml:"window" json:"window,omitempty"` // zscore: tickers, the sequence so far if 0
+}
+
+// Pipeline turns a ticker sequence into the model input. Features are computed
+// within the sequence only, so the same sequence gives the same input in live
+// trading, backtests and exported datasets.
+type Pipeline struct {
+	features []Feature
+}
+
+// fields of the default pipeline, the raw ticker the models were trained on
+var defaultFields = []string{"bid", "ask", "bid_size", "ask_size", "volume", "dtm", "last", "change", "open_interest"}
+
+// Default returns the pipeline of the raw numeric ticker fields
+func Default() *Pipeline {
+	features := make([]Feature, 0, len(defaultFields))
+	for _, field := range defaultFields {
+		features = append(features, Feature{Name: Field, Field: field})
+	}
+	return &Pipeline{features}
+}
+
+// New validates the features, the default pipeline is returned if there are none
+func New(features []Feature) (*Pipeline, error) {
+	if len(features) == 0 {
+		return Default(), nil
+	}
+	for _, f := range features {
+		switch f.Name {
+		case Field, Return, ZScore:
+			if _, err := value(domain.Ticker{}, f.field()); err != nil {
+				return nil, err
+			}
+			if f.Window < 0 {
+				return nil, fmt.Errorf("%w: %s window must not be negative", ErrInvalidFeature, f.Name)
+			}
+		case LogSpread, Imbalance, TimeOfDay:
+		default:
+			return nil, fmt.Errorf("%w: unknown feature %q", ErrInvalidFeature, f.Name)
+		}
+	}
+	return &Pipeline{features}, nil
+}
+
+// Names returns the column names
+func (p *Pipeline) Names() []string {
+	names := make([]string, 0, len(p.features))
+	for _, f := range p.features {
+		switch f.Name {
+		case Field:
+			names = append(names, f.field())
+		case Return, ZScore:
+			name := f.Name + "_" + f.field()
+			if f.Window > 0 {
+				name += "_" + strconv.Itoa(f.Window)
+			}
+			names = append(names, name)
+		case TimeOfDay:
+			names = append(names, "time_of_day_sin", "time_of_day_cos")
+		default:
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Transform returns a row of features per ticker
+func (p *Pipeline) Transform(tickers []domain.Ticker) [][]float64 {
+	rows := make([][]float64, len(tickers))
+	for i := range rows {
+		rows[i] = make([]float64, 0, len(p.features)+1)
+	}
+	for _, f := range p.features {
+		switch f.Name {
+		case Field:
+			for i, ticker := range tickers {
+				v, _ := value(ticker, f.field())
+				rows[i] = append(rows[i], v)
+			}
+		case Return:
+			for i, ticker := range tickers {
+				var r float64
+				if i > 0 {
+					prev, _ := value(tickers[i-1], f.field())
+					cur, _ := value(ticker, f.field())
+					r = logRatio(cur, prev)
+				}
+				rows[i] = append(rows[i], r)
+			}
+		case LogSpread:
+			for i, ticker := range tickers {
+				rows[i] = append(rows[i], logRatio(ticker.Ask, ticker.Bid))
+			}
+		case ZScore:
+			values := make([]float64, len(tickers))
+			for i, ticker := range tickers {
+				values[i], _ = value(ticker, f.field())
+			}
+			for i := range tickers {
+				start := 0
+				if f.Window > 0 && i+1 > f.Window {
+					start = i + 1 - f.Window
+				}
+				rows[i] = append(rows[i], zscore(values[start:i+1]))
+			}
+		case Imbalance:
+			for i, ticker := range tickers {
+				var imbalance float64
+				if total := ticker.BidSize + ticker.AskSize; total > 0 {
+					imbalance = (ticker.BidSize - ticker.AskSize) / total
+				}
+				rows[i] = append(rows[i], imbalance)
+			}
+		case TimeOfDay:
+			for i, ticker := range tickers {
+				t := time.Unix(0, ticker.Time*int64(time.Millisecond)).UTC()
+				midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+				angle := 2 * math.Pi * t.Sub(midnight).Seconds() / (24 * time.Hour).Seconds()
+				rows[i] = append(rows[i], math.Sin(angle), math.Cos(angle))
+			}
+		}
+	}
+	return rows
+}
+
+func (f Feature) field() string {
+	if f.Field == "" {
+		return "mid"
+	}
+	return f.Field
+}
+
+// value returns the numeric value of the ticker field
+func value(ticker domain.Ticker, field string) (float64, error) {
+	switch field {
+	case "bid":
+		return ticker.Bid, nil
+	case "ask":
+		return ticker.Ask, nil
+	case "mid":
+		return (ticker.Bid + ticker.Ask) / 2, nil
+	case "bid_size":
+		return ticker.BidSize, nil
+	case "ask_size":
+		return ticker.AskSize, nil
+	case "volume":
+		return ticker.Volume, nil
+	case "dtm":
+		return float64(ticker.Dtm), nil
+	case "last":
+		return ticker.Last, nil
+	case "change":
+		return ticker.Change, nil
+	case "open_interest":
+		return ticker.OpenInterest, nil
+	case "leverage":
+		return Leverage(ticker.Leverage), nil
+	}
+	return 0, fmt.Errorf("%w: unknown ticker field %q", ErrInvalidFeature, field)
+}
+
+// Leverage parses the leverage of the ticker like "50x", 0 if it's not a number
+func Leverage(leverage string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(leverage), "x"), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// logRatio returns log(a / b), 0 if any of them is not positive
+func logRatio(a float64, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	return math.Log(a / b)
+}
+
+// zscore returns the z-score of the last value, 0 if the values are constant
+func zscore(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(variance / float64(len(values)))
+	if std == 0 {
+		return 0
+	}
+	return (values[len(values)-1] - mean) / std
+}
@@ -0,0 +1,49 @@
+package features
+
+import (
+	"bot/domain"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	ticker := domain.Ticker{Bid: 1, Ask: 2, BidSize: 3, AskSize: 4, Volume: 5, Dtm: 6, Last: 7, Change: 8, OpenInterest: 9, Leverage: "50x"}
+	rows := Default().Transform([]domain.Ticker{ticker})
+	assert.Equal(t, [][]float64{{1, 2, 3, 4, 5, 6, 7, 8, 9}}, rows)
+}
+
+func TestPipeline_Transform(t *testing.T) {
+	pipeline, err := New([]Feature{
+		{Name: Return},
+		{Name: LogSpread},
+		{Name: ZScore, Field: "last", Window: 2},
+		{Name: Imbalance},
+		{Name: TimeOfDay},
+		{Name: Field, Field: "leverage"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"return_mid", "log_spread", "zscore_last_2", "imbalance",
+		"time_of_day_sin", "time_of_day_cos", "leverage"}, pipeline.Names())
+	tickers := []domain.Ticker{
+		{Time: 0, Bid: 99, Ask: 101, Last: 100, BidSize: 3, AskSize: 1, Leverage: "50x"},
+		{Time: 6 * 3600 * 1000, Bid: 109, Ask: 111, Last: 110, BidSize: 1, AskSize: 1, Leverage: "bad"},
+	}
+	rows := pipeline.Transform(tickers)
+	assert.Len(t, rows, 2)
+	assert.Len(t, rows[0], 7)
+	assert.Equal(t, 0.0, rows[0][0])
+	assert.InDelta(t, math.Log(1.1), rows[1][0], 1e-9)
+	assert.InDelta(t, math.Log(101.0/99), rows[0][1], 1e-9)
+	assert.Equal(t, 0.0, rows[0][2])
+	assert.InDelta(t, 1, rows[1][2], 1e-9)
+	assert.Equal(t, 0.5, rows[0][3])
+	// midnight and 6:00 UTC
+	assert.InDelta(t, 0, rows[0][4], 1e-9)
+	assert.InDelta(t, 1, rows[1][4], 1e-9)
+	assert.Equal(t, 50.0, rows[0][6])
+	assert.Equal(t, 0.0, rows[1][6])
+
+	_, err = New([]Feature{{Name: Field, Field: "unknown"}})
+	assert.ErrorIs(t, err, ErrInvalidFeature)
+}
@@ -1,23 +1,44 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 	//not-std
+	"bot/domain"
+	"bot/service"
 	"github.com/go-chi/chi/v5"
 )
 
 type BotService interface {
 	Start() error
-	Stop()
+	Stop(ctx context.Context) error
+	Status() service.Status
+	Parameters() service.Parameters
+	ChangeParameters(params service.Parameters) (service.Parameters, error)
+	SetKillSwitch(on bool)
+}
+
+// History provides stored trading results
+type History interface {
+	Orders(ctx context.Context, filter domain.OrderFilter) ([]domain.EventRecord, error)
+	Positions(ctx context.Context) ([]domain.Position, error)
+	DailyPnL(ctx context.Context, from time.Time, to time.Time) ([]domain.DailyPnL, error)
+	Vetoes(ctx context.Context, filter domain.OrderFilter) ([]domain.RiskVeto, error)
+	Predictions(ctx context.Context, filter domain.OrderFilter) ([]domain.PredictionRecord, error)
+	Prediction(ctx context.Context, decisionID string) (*domain.PredictionRecord, error)
 }
 
 type BotHandler struct {
 	service BotService
+	history History
 }
 
-func New(service BotService) *BotHandler {
-	return &BotHandler{service}
+func New(service BotService, history History) *BotHandler {
+	return &BotHandler{service, history}
 }
 
 func (b *BotHandler) Routes() chi.Router {
@@ -25,21 +46,82 @@ func (b *BotHandler) Routes() chi.Router {
 	r.Route("/", func(r chi.Router) {
 		r.Post("/start", b.start)
 		r.Post("/stop", b.stop)
-		//r.Post("/restart_with_new_settings", b.changeSettings)
+		r.Get("/status", b.status)
+		r.Get("/settings", b.settings)
+		r.Post("/restart_with_new_settings", b.changeSettings)
+		r.Get("/orders", b.orders)
+		r.Get("/positions", b.positions)
+		r.Get("/pnl", b.pnl)
+		r.Get("/vetoes", b.vetoes)
+		r.Get("/predictions", b.predictions)
+		r.Get("/predictions/{decisionID}", b.prediction)
+		r.Post("/kill_switch", b.killSwitchOn)
+		r.Delete("/kill_switch", b.killSwitchOff)
 	})
 	return r
 }
 
 func (b *BotHandler) start(w http.ResponseWriter, r *http.Request) {
 	err := b.service.Start()
+	if errors.Is(err, service.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 func (b *BotHandler) stop(w http.ResponseWriter, r *http.Request) {
-	b.service.Stop()
+	err := b.service.Stop(r.Context())
+	if errors.Is(err, service.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *BotHandler) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, b.service.Status())
+}
+
+func (b *BotHandler) settings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, b.service.Parameters())
+}
+
+func (b *BotHandler) changeSettings(w http.ResponseWriter, r *http.Request) {
+	var params service.Parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params, err := b.service.ChangeParameters(params)
+	if errors.Is(err, service.ErrInvalidParameters) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, params)
+}
+
+func (b *BotHandler) killSwitchOn(w http.ResponseWriter, r *http.Request) {
+	b.service.SetKillSwitch(true)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *BotHandler) killSwitchOff(w http.ResponseWriter, r *http.Request) {
+	b.service.SetKillSwitch(false)
 	w.WriteHeader(http.StatusOK)
 }
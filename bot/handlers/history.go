@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	//not-std
+	"bot/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /orders?symbol=&side=&from=&to=&limit=&offset=
+func (b *BotHandler) orders(w http.ResponseWriter, r *http.Request) {
+	filter, err := orderFilter(r.URL.Query(), domain.Buy, domain.Sell)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orders, err := b.history.Orders(r.Context(), filter)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, orders)
+}
+
+// GET /vetoes?symbol=&side=&from=&to=&limit=&offset=
+func (b *BotHandler) vetoes(w http.ResponseWriter, r *http.Request) {
+	filter, err := orderFilter(r.URL.Query(), domain.Buy, domain.Sell)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vetoes, err := b.history.Vetoes(r.Context(), filter)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, vetoes)
+}
+
+// GET /predictions?symbol=&side=&from=&to=&limit=&offset=, side is the action
+func (b *BotHandler) predictions(w http.ResponseWriter, r *http.Request) {
+	filter, err := orderFilter(r.URL.Query(), domain.Buy, domain.Sell, domain.None)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	predictions, err := b.history.Predictions(r.Context(), filter)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, predictions)
+}
+
+// GET /predictions/{decisionID} with the ticker sequence
+func (b *BotHandler) prediction(w http.ResponseWriter, r *http.Request) {
+	prediction, err := b.history.Prediction(r.Context(), chi.URLParam(r, "decisionID"))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if prediction == nil {
+		http.Error(w, "prediction not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, prediction)
+}
+
+// GET /positions
+func (b *BotHandler) positions(w http.ResponseWriter, r *http.Request) {
+	positions, err := b.history.Positions(r.Context())
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, positions)
+}
+
+// GET /pnl?from=&to=
+func (b *BotHandler) pnl(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	pnl, err := b.history.DailyPnL(r.Context(), from, to)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, pnl)
+}
+
+// orderFilter parses the filter parameters, side must be one of sides if set
+func orderFilter(query url.Values, sides ...domain.Action) (domain.OrderFilter, error) {
+	filter := domain.OrderFilter{
+		Symbol: query.Get("symbol"),
+		Side:   domain.Action(query.Get("side")),
+	}
+	if filter.Side != "" && !containsAction(sides, filter.Side) {
+		return filter, fmt.Errorf("invalid side: %q", filter.Side)
+	}
+	var err error
+	if filter.From, filter.To, err = timeRange(query); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = intParam(query, "limit"); err != nil {
+		return filter, err
+	}
+	filter.Offset, err = intParam(query, "offset")
+	return filter, err
+}
+
+func containsAction(actions []domain.Action, action domain.Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// timeRange parses from and to parameters in RFC 3339 or YYYY-MM-DD format,
+// to is exclusive, so a date includes the whole day
+func timeRange(query url.Values) (from time.Time, to time.Time, err error) {
+	parse := func(name string) (t time.Time, date bool, err error) {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}, false, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, false, nil
+		}
+		t, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s: %q", name, value)
+		}
+		return t, true, nil
+	}
+	if from, _, err = parse("from"); err != nil {
+		return
+	}
+	var date bool
+	if to, date, err = parse("to"); err == nil && date {
+		to = to.AddDate(0, 0, 1)
+	}
+	return
+}
+
+func intParam(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bot/domain"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type HistoryMock struct {
+	mock.Mock
+}
+
+func (m *HistoryMock) Orders(ctx context.Context, filter domain.OrderFilter) ([]domain.EventRecord, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]domain.EventRecord), args.Error(1)
+}
+
+func (m *HistoryMock) Positions(ctx context.Context) ([]domain.Position, error) {
+	return nil, nil
+}
+
+func (m *HistoryMock) DailyPnL(ctx context.Context, from time.Time, to time.Time) ([]domain.DailyPnL, error) {
+	args := m.Called(from, to)
+	return args.Get(0).([]domain.DailyPnL), args.Error(1)
+}
+
+func (m *HistoryMock) Vetoes(ctx context.Context, filter domain.OrderFilter) ([]domain.RiskVeto, error) {
+	return nil, nil
+}
+
+func (m *HistoryMock) Predictions(ctx context.Context, filter domain.OrderFilter) ([]domain.PredictionRecord, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]domain.PredictionRecord), args.Error(1)
+}
+
+func (m *HistoryMock) Prediction(ctx context.Context, decisionID string) (*domain.PredictionRecord, error) {
+	return nil, nil
+}
+
+func get(handler http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestBotHandler_Orders(t *testing.T) {
+	hm := HistoryMock{}
+	hm.On("Orders", mock.Anything).Return([]domain.EventRecord{}, nil)
+	routes := New(nil, &hm).Routes()
+
+	w := get(routes, "/orders?symbol=pi_xbtusd&side=sell&from=2021-02-01&to=2021-02-02&limit=10")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+	hm.AssertCalled(t, "Orders", domain.OrderFilter{
+		Symbol: "pi_xbtusd",
+		Side:   domain.Sell,
+		From:   time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+		// the whole day of to
+		To:    time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC),
+		Limit: 10,
+	})
+
+	for _, query := range []string{"side=none", "side=long", "from=yesterday", "limit=-1"} {
+		w = get(routes, "/orders?"+query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	hm.AssertNumberOfCalls(t, "Orders", 1)
+}
+
+func TestBotHandler_Predictions(t *testing.T) {
+	hm := HistoryMock{}
+	hm.On("Predictions", mock.Anything).Return([]domain.PredictionRecord{}, nil)
+	routes := New(nil, &hm).Routes()
+
+	w := get(routes, "/predictions?side=none&to=2021-02-02T10:00:00Z")
+	assert.Equal(t, http.StatusOK, w.Code)
+	hm.AssertCalled(t, "Predictions", domain.OrderFilter{
+		Side: domain.None,
+		To:   time.Date(2021, 2, 2, 10, 0, 0, 0, time.UTC),
+	})
+}
+
+func TestBotHandler_PnL(t *testing.T) {
+	hm := HistoryMock{}
+	hm.On("DailyPnL", mock.Anything, mock.Anything).Return([]domain.DailyPnL{}, nil)
+	routes := New(nil, &hm).Routes()
+
+	w := get(routes, "/pnl?from=2021-02-01&to=2021-02-01")
+	assert.Equal(t, http.StatusOK, w.Code)
+	hm.AssertCalled(t, "DailyPnL",
+		time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 2, 2, 0, 0, 0, 0, time.UTC))
+}
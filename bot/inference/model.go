@@ -0,0 +1,246 @@
+// Package inference runs Keras sequence models in process on the CPU.
+// The model is a JSON file with the weights of its layers exported by
+// model-serving-docker/export_weights.py.
+package inference
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Layer types
+const (
+	Dense              = "dense"
+	LSTM               = "lstm"
+	BatchNormalization = "batch_normalization"
+)
+
+var ErrInvalidModel = errors.New("invalid model")
+
+// Layer holds the Keras weights of a layer, only the fields of its type are set
+type Layer struct {
+	Type string `json:"type"`
+	// dense and lstm
+	Kernel [][]float64 `json:"kernel,omitempty"` // input x units (x 4 gates for lstm)
+	Bias   []float64   `json:"bias,omitempty"`
+	// dense: linear, relu, sigmoid or tanh
+	Activation string `json:"activation,omitempty"`
+	// lstm, gates in the Keras order: input, forget, cell, output
+	RecurrentKernel [][]float64 `json:"recurrent_kernel,omitempty"` // units x 4 units
+	ReturnSequences bool        `json:"return_sequences,omitempty"`
+	// batch_normalization
+	Gamma          []float64 `json:"gamma,omitempty"`
+	Beta           []float64 `json:"beta,omitempty"`
+	MovingMean     []float64 `json:"moving_mean,omitempty"`
+	MovingVariance []float64 `json:"moving_variance,omitempty"`
+	Epsilon        float64   `json:"epsilon,omitempty"` // DefaultEpsilon if 0
+}
+
+// DefaultEpsilon is the epsilon of Keras BatchNormalization
+const DefaultEpsilon = 1e-3
+
+// Sample is an input sequence with the output of the original model
+type Sample struct {
+	Input  [][]float64 `json:"input"`
+	Output float64     `json:"output"`
+}
+
+// Model is a stack of layers applied to a sequence of feature vectors
+type Model struct {
+	InputSize int      `json:"input_size"`
+	Layers    []Layer  `json:"layers"`
+	Samples   []Sample `json:"samples,omitempty"` // to validate the export
+}
+
+// Load reads and checks the model file
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	for i := range m.Layers {
+		if l := &m.Layers[i]; l.Type == BatchNormalization && l.Epsilon == 0 {
+			l.Epsilon = DefaultEpsilon
+		}
+	}
+	return &m, nil
+}
+
+// check validates the shapes of the layers
+func (m *Model) check() error {
+	if len(m.Layers) == 0 || m.InputSize <= 0 {
+		return fmt.Errorf("%w: no layers or input size", ErrInvalidModel)
+	}
+	size := m.InputSize
+	for i, l := range m.Layers {
+		var units int
+		switch l.Type {
+		case Dense, LSTM:
+			gates := 1
+			if l.Type == LSTM {
+				gates = 4
+			}
+			if len(l.Kernel) != size || len(l.Kernel[0]) == 0 || len(l.Kernel[0])%gates != 0 {
+				return fmt.Errorf("%w: layer %d: kernel must be %d x units", ErrInvalidModel, i, size)
+			}
+			units = len(l.Kernel[0]) / gates
+			if !rectangular(l.Kernel, units*gates) || len(l.Bias) != units*gates {
+				return fmt.Errorf("%w: layer %d: kernel and bias sizes don't match", ErrInvalidModel, i)
+			}
+			if l.Type == LSTM && (len(l.RecurrentKernel) != units || !rectangular(l.RecurrentKernel, 4*units)) {
+				return fmt.Errorf("%w: layer %d: recurrent kernel must be units x 4 units", ErrInvalidModel, i)
+			}
+			if _, ok := activations[l.Activation]; l.Type == Dense && !ok {
+				return fmt.Errorf("%w: layer %d: unknown activation %q", ErrInvalidModel, i, l.Activation)
+			}
+		case BatchNormalization:
+			units = size
+			if len(l.Gamma) != size || len(l.Beta) != size || len(l.MovingMean) != size || len(l.MovingVariance) != size {
+				return fmt.Errorf("%w: layer %d: batch normalization of %d features is expected", ErrInvalidModel, i, size)
+			}
+		default:
+			return fmt.Errorf("%w: layer %d: unknown type %q", ErrInvalidModel, i, l.Type)
+		}
+		size = units
+	}
+	return nil
+}
+
+// Predict returns the first output of the last step of the sequence
+func (m *Model) Predict(sequence [][]float64) (float64, error) {
+	if len(sequence) == 0 {
+		return 0, fmt.Errorf("%w: empty sequence", ErrInvalidModel)
+	}
+	for _, x := range sequence {
+		if len(x) != m.InputSize {
+			return 0, fmt.Errorf("%w: %d features, the model expects %d", ErrInvalidModel, len(x), m.InputSize)
+		}
+	}
+	for _, l := range m.Layers {
+		switch l.Type {
+		case Dense:
+			sequence = l.dense(sequence)
+		case LSTM:
+			sequence = l.lstm(sequence)
+		case BatchNormalization:
+			sequence = l.batchNormalization(sequence)
+		}
+	}
+	return sequence[len(sequence)-1][0], nil
+}
+
+// Validate returns the largest difference from the outputs of the samples
+func (m *Model) Validate() (float64, error) {
+	var maxDiff float64
+	for _, sample := range m.Samples {
+		value, err := m.Predict(sample.Input)
+		if err != nil {
+			return 0, err
+		}
+		maxDiff = math.Max(maxDiff, math.Abs(value-sample.Output))
+	}
+	return maxDiff, nil
+}
+
+// dense is applied to every step like Keras Dense on 3D input
+func (l Layer) dense(sequence [][]float64) [][]float64 {
+	activation := activations[l.Activation]
+	out := make([][]float64, len(sequence))
+	for t, x := range sequence {
+		y := matVec(x, l.Kernel, l.Bias)
+		for i := range y {
+			y[i] = activation(y[i])
+		}
+		out[t] = y
+	}
+	return out
+}
+
+func (l Layer) lstm(sequence [][]float64) [][]float64 {
+	units := len(l.RecurrentKernel)
+	h := make([]float64, units)
+	c := make([]float64, units)
+	out := make([][]float64, 0, len(sequence))
+	for _, x := range sequence {
+		z := matVec(x, l.Kernel, l.Bias)
+		recurrent := matVec(h, l.RecurrentKernel, nil)
+		next := make([]float64, units)
+		for j := 0; j < units; j++ {
+			i := sigmoid(z[j] + recurrent[j])
+			f := sigmoid(z[units+j] + recurrent[units+j])
+			g := math.Tanh(z[2*units+j] + recurrent[2*units+j])
+			o := sigmoid(z[3*units+j] + recurrent[3*units+j])
+			c[j] = f*c[j] + i*g
+			next[j] = o * math.Tanh(c[j])
+		}
+		h = next
+		if l.ReturnSequences {
+			out = append(out, h)
+		}
+	}
+	if !l.ReturnSequences {
+		out = append(out, h)
+	}
+	return out
+}
+
+// batchNormalization uses the moving statistics as Keras does in inference
+func (l Layer) batchNormalization(sequence [][]float64) [][]float64 {
+	out := make([][]float64, len(sequence))
+	for t, x := range sequence {
+		y := make([]float64, len(x))
+		for i := range x {
+			y[i] = l.Gamma[i]*(x[i]-l.MovingMean[i])/math.Sqrt(l.MovingVariance[i]+l.Epsilon) + l.Beta[i]
+		}
+		out[t] = y
+	}
+	return out
+}
+
+var activations = map[string]func(float64) float64{
+	"":        func(x float64) float64 { return x },
+	"linear":  func(x float64) float64 { return x },
+	"relu":    func(x float64) float64 { return math.Max(x, 0) },
+	"sigmoid": sigmoid,
+	"tanh":    math.Tanh,
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// matVec returns x * kernel + bias, kernel is len(x) x n
+func matVec(x []float64, kernel [][]float64, bias []float64) []float64 {
+	n := len(kernel[0])
+	y := make([]float64, n)
+	copy(y, bias)
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		row := kernel[i]
+		for j := 0; j < n; j++ {
+			y[j] += xi * row[j]
+		}
+	}
+	return y
+}
+
+func rectangular(matrix [][]float64, width int) bool {
+	for _, row := range matrix {
+		if len(row) != width {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package inference
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModel_Predict(t *testing.T) {
+	model, err := Load("testdata/model.json")
+	assert.Nil(t, err)
+	// batch normalization, lstm and dense layers against a reference computation
+	value, err := model.Predict([][]float64{{2, 1}, {0, -1}, {1, 0.5}})
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.27404406513392665, value, 1e-12)
+	diff, err := model.Validate()
+	assert.Nil(t, err)
+	assert.Less(t, diff, 1e-12)
+
+	_, err = model.Predict([][]float64{{1, 2, 3}})
+	assert.ErrorIs(t, err, ErrInvalidModel)
+}
+
+func TestModel_Check(t *testing.T) {
+	model, _ := Load("testdata/model.json")
+	model.Layers[1].RecurrentKernel = append(model.Layers[1].RecurrentKernel, []float64{0, 0, 0, 0})
+	assert.ErrorIs(t, model.check(), ErrInvalidModel)
+
+	model, _ = Load("testdata/model.json")
+	model.Layers[3].Activation = "softmax"
+	assert.ErrorIs(t, model.check(), ErrInvalidModel)
+
+	// a layer without units
+	model, _ = Load("testdata/model.json")
+	model.Layers[3].Kernel = [][]float64{{}, {}}
+	model.Layers[3].Bias = nil
+	assert.ErrorIs(t, model.check(), ErrInvalidModel)
+}
+
+func TestLoad_DefaultEpsilon(t *testing.T) {
+	data, err := os.ReadFile("testdata/model.json")
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "model.json")
+	assert.Nil(t, os.WriteFile(path, bytes.Replace(data, []byte(`, "epsilon": 1`), nil, 1), 0644))
+	model, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultEpsilon, model.Layers[0].Epsilon)
+}
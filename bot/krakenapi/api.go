@@ -2,40 +2,77 @@ package krakenapi
 
 import (
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 	// not-std
-	"github.com/gorilla/websocket"
+	"bot/domain"
 )
 
 const (
-	WebSocketURL     = "wss://demo-futures.kraken.com/ws/v1"
-	SendOrderURL     = "https://demo-futures.kraken.com/derivatives/api/v3/sendorder?"
-	CancelOrdersURL  = "https://demo-futures.kraken.com/derivatives/api/v3/cancelallorders"
-	OpenPositionsURL = "https://demo-futures.kraken.com/derivatives/api/v3/openpositions"
+	DefaultWebSocketURL = "wss://demo-futures.kraken.com/ws/v1"
+	DefaultRestURL      = "https://demo-futures.kraken.com/derivatives"
+)
+
+// Endpoint paths relative to the rest url, also used for signing
+const (
+	SendOrderPath     = "/api/v3/sendorder"
+	CancelOrderPath   = "/api/v3/cancelorder"
+	CancelOrdersPath  = "/api/v3/cancelallorders"
+	OpenPositionsPath = "/api/v3/openpositions"
 )
 const DefaultHttpTimeout = 10 * time.Second
 
+// WebSocket defaults
+const (
+	DefaultReconnectMinDelay = 500 * time.Millisecond
+	DefaultReconnectMaxDelay = 30 * time.Second
+	DefaultPingInterval      = 10 * time.Second
+	DefaultStaleTimeout      = 30 * time.Second
+)
+
 type Config struct {
-	PublicKey   string `yaml:"public_key"`
-	PrivateKey  string `yaml:"private_key"`
-	HttpTimeout string `yaml:"http_timeout"`
+	PublicKey    string `yaml:"public_key"`
+	PrivateKey   string `yaml:"private_key"`
+	HttpTimeout  string `yaml:"http_timeout"`
+	RestURL      string `yaml:"rest_url"`
+	WebSocketURL string `yaml:"websocket_url"`
+	// reconnection backoff, doubled after every failed attempt
+	ReconnectMinDelay string `yaml:"reconnect_min_delay"`
+	ReconnectMaxDelay string `yaml:"reconnect_max_delay"`
+	PingInterval      string `yaml:"ping_interval"`
+	// reconnect if no public feed message is received for this time
+	StaleTimeout string `yaml:"stale_timeout"`
 }
 
 type KrakenAPI struct {
-	publicKey  string
-	privateKey string
-	client     *http.Client
-	conn       *websocket.Conn
-	closed     bool
+	publicKey    string
+	privateKey   string
+	restURL      string
+	webSocketURL string
+	client       *http.Client
+	// websocket
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	pingInterval time.Duration
+	staleTimeout time.Duration
+	events       chan domain.ConnectionEvent
+	mu           sync.Mutex
+	stream       *Stream // ticker subscription
 }
 
 func New(publicKey string, privateKey string, timeout time.Duration) *KrakenAPI {
 	return &KrakenAPI{
-		publicKey,
-		privateKey,
-		&http.Client{Timeout: timeout},
-		nil,
-		false,
+		publicKey:    publicKey,
+		privateKey:   privateKey,
+		restURL:      DefaultRestURL,
+		webSocketURL: DefaultWebSocketURL,
+		client:       &http.Client{Timeout: timeout},
+		minDelay:     DefaultReconnectMinDelay,
+		maxDelay:     DefaultReconnectMaxDelay,
+		pingInterval: DefaultPingInterval,
+		staleTimeout: DefaultStaleTimeout,
+		events:       make(chan domain.ConnectionEvent, eventsBuffer),
 	}
 }
 
@@ -44,5 +81,29 @@ func NewWithConfig(config Config) *KrakenAPI {
 	if err != nil {
 		timeout = DefaultHttpTimeout
 	}
-	return New(config.PublicKey, config.PrivateKey, timeout)
+	k := New(config.PublicKey, config.PrivateKey, timeout)
+	if config.RestURL != "" {
+		k.restURL = strings.TrimSuffix(config.RestURL, "/")
+	}
+	if config.WebSocketURL != "" {
+		k.webSocketURL = config.WebSocketURL
+	}
+	parseDuration(config.ReconnectMinDelay, &k.minDelay)
+	parseDuration(config.ReconnectMaxDelay, &k.maxDelay)
+	parseDuration(config.PingInterval, &k.pingInterval)
+	parseDuration(config.StaleTimeout, &k.staleTimeout)
+	return k
+}
+
+// parseDuration keeps the default if the value is empty or invalid
+func parseDuration(value string, d *time.Duration) {
+	if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+		*d = parsed
+	}
+}
+
+// ConnectionEvents reports connection state changes of all streams,
+// events are dropped if nobody reads them
+func (k *KrakenAPI) ConnectionEvents() <-chan domain.ConnectionEvent {
+	return k.events
 }
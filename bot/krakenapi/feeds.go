@@ -0,0 +1,99 @@
+package krakenapi
+
+import (
+	"encoding/json"
+	"fmt"
+	// not-std
+	"bot/domain"
+)
+
+type decoder func(data []byte) (interface{}, error)
+
+// decoders by the feed field of a message
+var decoders = map[string]decoder{
+	domain.TickerFeed: func(data []byte) (interface{}, error) {
+		v := domain.Ticker{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.BookSnapshotFeed: func(data []byte) (interface{}, error) {
+		v := domain.BookSnapshot{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.BookFeed: func(data []byte) (interface{}, error) {
+		v := domain.BookUpdate{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.TradeSnapshotFeed: func(data []byte) (interface{}, error) {
+		v := domain.TradeSnapshot{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.TradeFeed: func(data []byte) (interface{}, error) {
+		v := domain.Trade{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.FillsSnapshotFeed: decodeFills,
+	domain.FillsFeed:         decodeFills,
+	domain.OpenOrdersSnapshotFeed: func(data []byte) (interface{}, error) {
+		v := domain.OpenOrdersSnapshot{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.OpenOrdersFeed: func(data []byte) (interface{}, error) {
+		v := domain.OpenOrderUpdate{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+	domain.OpenPositionsFeed: func(data []byte) (interface{}, error) {
+		v := domain.OpenPositions{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	},
+}
+
+func decodeFills(data []byte) (interface{}, error) {
+	v := domain.Fills{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+type header struct {
+	Event   string `json:"event"`
+	Feed    string `json:"feed"`
+	Message string `json:"message"`
+}
+
+// Decode dispatches a feed message by its feed field and returns one of
+// domain.Ticker, BookSnapshot, BookUpdate, TradeSnapshot, Trade, Fills,
+// OpenOrdersSnapshot, OpenOrderUpdate or OpenPositions.
+// Control messages (info, subscribed, heartbeat...) and unknown feeds return nil.
+func Decode(data []byte) (interface{}, error) {
+	h := header{}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("can't decode message: %w", err)
+	}
+	if h.Event == "error" {
+		return nil, fmt.Errorf("feed error: %s", h.Message)
+	}
+	if h.Event != "" {
+		return nil, nil
+	}
+	decode, ok := decoders[h.Feed]
+	if !ok {
+		return nil, nil
+	}
+	msg, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode %s message: %w", h.Feed, err)
+	}
+	return msg, nil
+}
+
+// SignChallenge signs the challenge of the private feeds with the api secret
+func SignChallenge(challenge string, privateKey string) string {
+	return generateSign([]byte(challenge), nil, privateKey)
+}
@@ -0,0 +1,139 @@
+package krakenapi_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/krakenapi"
+	"bot/krakensim"
+	"bot/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	publicKey  = "public"
+	privateKey = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+)
+
+var ticker = domain.Ticker{
+	ProductId: "PI_XBTUSD",
+	Bid:       34832.5,
+	Ask:       34847.5,
+	BidSize:   42864,
+	AskSize:   2300,
+}
+
+func newTestAPI(t *testing.T, config krakenapi.Config) (*krakensim.Server, *krakenapi.KrakenAPI) {
+	sim := krakensim.New(simulator.New(), publicKey, privateKey)
+	ts := httptest.NewServer(sim.Routes())
+	t.Cleanup(ts.Close)
+	config.RestURL = ts.URL + "/derivatives"
+	config.WebSocketURL = "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/v1"
+	return sim, krakenapi.NewWithConfig(config)
+}
+
+func TestKrakenAPI_SendOrder(t *testing.T) {
+	sim, api := newTestAPI(t, krakenapi.Config{PublicKey: publicKey, PrivateKey: privateKey})
+	sim.Broadcast(ticker)
+	resp, err := api.SendOrder(context.Background(), *domain.NewOrder("pi_xbtusd", domain.Buy, domain.IocType, 35000, 10))
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Success, resp.Result)
+	assert.Equal(t, simulator.StatusPlaced, resp.SendStatus.Status)
+	assert.Equal(t, int64(10), resp.SendStatus.OrderEvents[0].Amount)
+	assert.Equal(t, ticker.Ask, resp.SendStatus.OrderEvents[0].Price)
+
+	positions, err := api.GetPositions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.Position{{Side: "long", Symbol: "pi_xbtusd", Price: ticker.Ask, Size: 10}}, positions.OpenPositions)
+}
+
+func TestKrakenAPI_WrongSign(t *testing.T) {
+	_, api := newTestAPI(t, krakenapi.Config{PublicKey: publicKey, PrivateKey: "d3Jvbmc="})
+	resp, err := api.GetPositions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Error, resp.Result)
+	assert.Equal(t, "authenticationError", *resp.Error)
+}
+
+func TestKrakenAPI_Subscribe(t *testing.T) {
+	sim, api := newTestAPI(t, krakenapi.Config{PublicKey: publicKey, PrivateKey: privateKey})
+	tickers, err := api.Subscribe(ticker.ProductId)
+	assert.Nil(t, err)
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(10 * time.Millisecond)
+			sim.Broadcast(ticker)
+		}
+	}()
+	for received := range tickers {
+		if received.ProductId == ticker.ProductId {
+			assert.Equal(t, ticker.Bid, received.Bid)
+			break
+		}
+	}
+	assert.Nil(t, api.Unsubscribe())
+}
+
+func TestKrakenAPI_PrivateFeeds(t *testing.T) {
+	sim, api := newTestAPI(t, krakenapi.Config{PublicKey: publicKey, PrivateKey: privateKey})
+	sim.Broadcast(ticker)
+	stream, err := api.OpenStream(
+		krakenapi.Subscription{Feed: domain.FillsFeed},
+		krakenapi.Subscription{Feed: domain.OpenPositionsFeed},
+	)
+	assert.Nil(t, err)
+	defer stream.Close()
+
+	snapshot := (<-stream.Messages()).(domain.Fills)
+	assert.Equal(t, domain.FillsSnapshotFeed, snapshot.Feed)
+	positions := (<-stream.Messages()).(domain.OpenPositions)
+	assert.Empty(t, positions.Positions)
+
+	_, err = api.SendOrder(context.Background(), *domain.NewOrder("pi_xbtusd", domain.Sell, domain.IocType, 34000, 5))
+	assert.Nil(t, err)
+	fills := (<-stream.Messages()).(domain.Fills)
+	assert.Equal(t, domain.FillsFeed, fills.Feed)
+	assert.Equal(t, []domain.Fill{{
+		Instrument: "pi_xbtusd", Time: fills.Fills[0].Time, Price: ticker.Bid, Qty: 5,
+		OrderID: fills.Fills[0].OrderID, FillID: fills.Fills[0].FillID, FillType: "taker",
+	}}, fills.Fills)
+	positions = (<-stream.Messages()).(domain.OpenPositions)
+	assert.Equal(t, -5.0, positions.Positions[0].Balance)
+}
+
+func TestDecode(t *testing.T) {
+	msg, err := krakenapi.Decode([]byte(`{"event":"subscribed","feed":"ticker","product_ids":["PI_XBTUSD"]}`))
+	assert.Nil(t, err)
+	assert.Nil(t, msg)
+	msg, err = krakenapi.Decode([]byte(`{"feed":"book","product_id":"PI_XBTUSD","side":"sell","seq":2,"price":34900,"qty":0}`))
+	assert.Nil(t, err)
+	assert.Equal(t, domain.BookUpdate{Feed: "book", ProductId: "PI_XBTUSD", Side: "sell", Seq: 2, Price: 34900}, msg)
+	_, err = krakenapi.Decode([]byte(`{"event":"error","message":"Invalid product id"}`))
+	assert.NotNil(t, err)
+}
+
+func TestKrakenAPI_StaleFeedReconnect(t *testing.T) {
+	_, api := newTestAPI(t, krakenapi.Config{
+		PublicKey:         publicKey,
+		PrivateKey:        privateKey,
+		ReconnectMinDelay: "1ms",
+		PingInterval:      "10ms",
+		StaleTimeout:      "30ms",
+	})
+	_, err := api.Subscribe(ticker.ProductId)
+	assert.Nil(t, err)
+	var states []string
+	for event := range api.ConnectionEvents() {
+		states = append(states, event.State)
+		if len(states) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []string{domain.Connected, domain.Reconnecting, domain.Connected}, states)
+	assert.Nil(t, api.Unsubscribe())
+	assert.Equal(t, domain.Closed, (<-api.ConnectionEvents()).State)
+}
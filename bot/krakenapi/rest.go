@@ -1,6 +1,7 @@
 package krakenapi
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -16,16 +17,16 @@ import (
 	"bot/domain"
 )
 
-func (k *KrakenAPI) GetPositions() (*domain.OpenPositionsResponse, error) {
-	u, err := url.Parse(OpenPositionsURL)
+func (k *KrakenAPI) GetPositions(ctx context.Context) (*domain.OpenPositionsResponse, error) {
+	u, err := url.Parse(k.restURL + OpenPositionsPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse url: %w", err)
 	}
-	req, err := http.NewRequest(http.MethodGet, u.String(), strings.NewReader(u.RawQuery))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), strings.NewReader(u.RawQuery))
 	if err != nil {
 		return nil, fmt.Errorf("can't create request: %w", err)
 	}
-	req, err = k.privateRequest(req)
+	req, err = k.privateRequest(req, OpenPositionsPath)
 	if err != nil {
 		return nil, fmt.Errorf("can't make private request: %w", err)
 	}
@@ -40,8 +41,8 @@ func (k *KrakenAPI) GetPositions() (*domain.OpenPositionsResponse, error) {
 	return resp, nil
 }
 
-func (k *KrakenAPI) SendOrder(order domain.Order) (*domain.SendOrderResponse, error) {
-	u, _ := url.Parse(SendOrderURL)
+func (k *KrakenAPI) SendOrder(ctx context.Context, order domain.Order) (*domain.SendOrderResponse, error) {
+	u, _ := url.Parse(k.restURL + SendOrderPath)
 	values := url.Values{}
 	values.Set("symbol", order.Symbol)
 	//values.Set("limitPrice", strconv.FormatFloat(order.LimitPrice, 'f', 2, 64))
@@ -50,11 +51,11 @@ func (k *KrakenAPI) SendOrder(order domain.Order) (*domain.SendOrderResponse, er
 	values.Set("side", string(order.Side))
 	values.Set("orderType", string(order.Type))
 	u.RawQuery = values.Encode()
-	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(u.RawQuery))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(u.RawQuery))
 	if err != nil {
 		return nil, fmt.Errorf("can't create request: %w", err)
 	}
-	req, err = k.privateRequest(req)
+	req, err = k.privateRequest(req, SendOrderPath)
 	if err != nil {
 		return nil, fmt.Errorf("can't make private request: %w", err)
 	}
@@ -69,13 +70,35 @@ func (k *KrakenAPI) SendOrder(order domain.Order) (*domain.SendOrderResponse, er
 	return resp, err
 }
 
-func (k *KrakenAPI) CancelOrders() (*domain.CancelOrdersResponse, error) {
-	u, _ := url.Parse(CancelOrdersURL)
-	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(u.RawQuery))
+func (k *KrakenAPI) CancelOrders(ctx context.Context) (*domain.CancelOrdersResponse, error) {
+	u, _ := url.Parse(k.restURL + CancelOrdersPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(u.RawQuery))
 	if err != nil {
 		return nil, fmt.Errorf("can't create request: %w", err)
 	}
-	req, err = k.privateRequest(req)
+	req, err = k.privateRequest(req, CancelOrdersPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't make private request: %w", err)
+	}
+	respBody, err := k.sendRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't send request: %w", err)
+	}
+	resp := &domain.CancelOrdersResponse{}
+	err = json.Unmarshal(respBody, resp)
+	return resp, err
+}
+
+func (k *KrakenAPI) CancelOrder(ctx context.Context, orderID string) (*domain.CancelOrdersResponse, error) {
+	u, _ := url.Parse(k.restURL + CancelOrderPath)
+	values := url.Values{}
+	values.Set("order_id", orderID)
+	u.RawQuery = values.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(u.RawQuery))
+	if err != nil {
+		return nil, fmt.Errorf("can't create request: %w", err)
+	}
+	req, err = k.privateRequest(req, CancelOrderPath)
 	if err != nil {
 		return nil, fmt.Errorf("can't make private request: %w", err)
 	}
@@ -90,7 +113,7 @@ func (k *KrakenAPI) CancelOrders() (*domain.CancelOrdersResponse, error) {
 
 // Helpers
 
-func (k *KrakenAPI) privateRequest(req *http.Request) (*http.Request, error) {
+func (k *KrakenAPI) privateRequest(req *http.Request, endpointPath string) (*http.Request, error) {
 	// Get sign
 	body, err := req.GetBody()
 	if err != nil {
@@ -100,8 +123,7 @@ func (k *KrakenAPI) privateRequest(req *http.Request) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	endpointPath := []byte(req.URL.Path[12:])
-	sign := generateSign(postData, endpointPath, k.privateKey)
+	sign := generateSign(postData, []byte(endpointPath), k.privateKey)
 	// Add headers
 	req.Header.Add("APIKey", k.publicKey)
 	req.Header.Add("Authent", sign)
@@ -118,6 +140,12 @@ func (k *KrakenAPI) sendRequest(req *http.Request) ([]byte, error) {
 	return bodyBytes, err
 }
 
+// CheckSign verifies the Authent header value of a private request
+func CheckSign(postData []byte, endpointPath []byte, privateKey string, sign string) bool {
+	expected := generateSign(postData, endpointPath, privateKey)
+	return hmac.Equal([]byte(expected), []byte(sign))
+}
+
 func generateSign(postData []byte, endpointPath []byte, privateKey string) string {
 	// Concatenate postData + nonce + endpointPath
 	src := append(postData, endpointPath...)
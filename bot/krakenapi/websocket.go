@@ -1,80 +1,340 @@
 package krakenapi
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	// not-std
 	"bot/domain"
+	"bot/metrics"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 )
 
 const ReconnectAttempts = 10
 
-var ErrMaxReconnects = errors.New("the maximum number of reconnection attempts has been reached")
+const (
+	// challengeReadLimit is the number of messages to skip while waiting for the challenge
+	challengeReadLimit = 10
+	writeWait          = 5 * time.Second
+	eventsBuffer       = 16
+)
+
+var (
+	ErrMaxReconnects = errors.New("the maximum number of reconnection attempts has been reached")
+	ErrStreamClosed  = errors.New("stream is closed")
+)
 
-func (k *KrakenAPI) Connect(trialNum int) error {
-	if trialNum < 0 {
-		return ErrMaxReconnects
+// Subscription of a stream, product ids are used by the public feeds only
+type Subscription struct {
+	Feed       string
+	ProductIDs []string
+}
+
+// Stream is a WebSocket connection subscribed to one or more feeds. Messages are
+// decoded by Decode. The connection is pinged, and reestablished with backoff and
+// resubscribed on errors, missing pongs or a stale public feed.
+type Stream struct {
+	k        *KrakenAPI
+	subs     []Subscription
+	out      chan interface{}
+	done     chan struct{}
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	closed   bool
+	closeOne sync.Once
+	// unix nano of the last feed message and pong
+	lastMessage int64
+	lastPong    int64
+}
+
+// OpenStream connects and subscribes to the feeds, private feeds are
+// authenticated with the challenge of the api key
+func (k *KrakenAPI) OpenStream(subs ...Subscription) (*Stream, error) {
+	s := &Stream{
+		k:    k,
+		subs: subs,
+		out:  make(chan interface{}),
+		done: make(chan struct{}),
 	}
-	if c, _, err := websocket.DefaultDialer.Dial(WebSocketURL, nil); err == nil {
-		k.conn = c
-		k.closed = false
-		return nil
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
 	}
-	return k.Connect(trialNum - 1)
+	go s.read(conn)
+	return s, nil
 }
 
-func (k *KrakenAPI) Subscribe(productIDs ...string) (<-chan domain.Ticker, error) {
-	out := make(chan domain.Ticker)
-	ConnectAndSendMsg := func(msg domain.Message) error {
-		if err := k.Connect(ReconnectAttempts); err != nil {
+// Messages are closed when the stream is closed or can't reconnect
+func (s *Stream) Messages() <-chan interface{} {
+	return s.out
+}
+
+func (s *Stream) Close() error {
+	var err error
+	s.closeOne.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.done)
+		// don't wait for the close reply forever
+		_ = s.conn.SetReadDeadline(time.Now().Add(writeWait))
+		err = s.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	})
+	return err
+}
+
+func (s *Stream) read(conn *websocket.Conn) {
+	defer close(s.out)
+	for {
+		err := s.readConn(conn)
+		if s.isClosed() {
+			log.Info("normal termination")
+			s.emit(domain.Closed, nil)
+			return
+		}
+		log.Warning("websocket: ", err, ", retry to connect")
+		s.emit(domain.Reconnecting, err)
+		metrics.WebSocketReconnects.Inc()
+		if conn, err = s.connect(); err != nil {
+			if !errors.Is(err, ErrStreamClosed) {
+				log.Error(err)
+				s.emit(domain.Disconnected, err)
+			}
+			return
+		}
+	}
+}
+
+// readConn reads the connection until an error and closes it, control messages are skipped
+func (s *Stream) readConn(conn *websocket.Conn) error {
+	defer conn.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.monitor(conn, stop)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			return err
 		}
-		if err := k.conn.WriteJSON(msg); err != nil {
-			return fmt.Errorf("can't write to websocket: %w", err)
+		msg, err := Decode(data)
+		if err != nil {
+			log.Warning("websocket: ", err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+		atomic.StoreInt64(&s.lastMessage, time.Now().UnixNano())
+		select {
+		case s.out <- msg:
+		case <-s.done:
+			return ErrStreamClosed
+		}
+	}
+}
+
+// monitor pings the connection and closes it if pongs or feed messages stop coming
+func (s *Stream) monitor(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.k.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			var reason string
+			if err := conn.WriteControl(websocket.PingMessage, nil, now.Add(writeWait)); err != nil {
+				reason = "ping failed: " + err.Error()
+			}
+			if now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastPong))) > 2*s.k.pingInterval {
+				reason = "no pong"
+			}
+			if s.public() && now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastMessage))) > s.k.staleTimeout {
+				reason = "stale feed"
+			}
+			if reason != "" {
+				log.Warning("websocket: ", reason)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// public reports whether the stream has public feeds, private feeds may be silent
+func (s *Stream) public() bool {
+	for _, sub := range s.subs {
+		if !domain.PrivateFeeds[sub.Feed] {
+			return true
 		}
+	}
+	return false
+}
+
+func (s *Stream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Stream) feeds() string {
+	feeds := make([]string, len(s.subs))
+	for i, sub := range s.subs {
+		feeds[i] = sub.Feed
+	}
+	return strings.Join(feeds, ",")
+}
+
+func (s *Stream) emit(state string, err error) {
+	event := domain.ConnectionEvent{Time: time.Now(), Feeds: s.feeds(), State: state}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	select {
+	case s.k.events <- event:
+	default:
+	}
+}
+
+func (s *Stream) connect() (*websocket.Conn, error) {
+	conn, err := s.k.dial(s.done)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.subscribe(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&s.lastMessage, now)
+	atomic.StoreInt64(&s.lastPong, now)
+	conn.SetPongHandler(func(string) error {
+		atomic.StoreInt64(&s.lastPong, time.Now().UnixNano())
 		return nil
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return nil, ErrStreamClosed
 	}
-	msg := domain.Message{
-		Event:      "subscribe",
-		Feed:       "ticker",
-		ProductIDs: productIDs,
+	s.conn = conn
+	s.emit(domain.Connected, nil)
+	return conn, nil
+}
+
+func (s *Stream) subscribe(conn *websocket.Conn) error {
+	var challenge, signed string
+	for _, sub := range s.subs {
+		msg := domain.Message{Event: "subscribe", Feed: sub.Feed, ProductIDs: sub.ProductIDs}
+		if domain.PrivateFeeds[sub.Feed] {
+			if challenge == "" {
+				var err error
+				if challenge, err = s.k.challenge(conn); err != nil {
+					return err
+				}
+				signed = SignChallenge(challenge, s.k.privateKey)
+			}
+			msg.APIKey = s.k.publicKey
+			msg.OriginalChallenge = challenge
+			msg.SignedChallenge = signed
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			return fmt.Errorf("can't write to websocket: %w", err)
+		}
 	}
-	if err := ConnectAndSendMsg(msg); err != nil {
-		return out, err
+	return nil
+}
+
+// dial connects with exponential backoff and jitter between attempts
+func (k *KrakenAPI) dial(done <-chan struct{}) (*websocket.Conn, error) {
+	delay := k.minDelay
+	for attempt := 0; ; attempt++ {
+		conn, _, err := websocket.DefaultDialer.Dial(k.webSocketURL, nil)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt == ReconnectAttempts {
+			return nil, fmt.Errorf("%w: %v", ErrMaxReconnects, err)
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		log.Warningf("websocket: %v, retry in %v", err, wait)
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return nil, ErrStreamClosed
+		}
+		if delay *= 2; delay > k.maxDelay {
+			delay = k.maxDelay
+		}
+	}
+}
+
+// challenge requests the string to sign for the private feeds
+func (k *KrakenAPI) challenge(conn *websocket.Conn) (string, error) {
+	if err := conn.WriteJSON(map[string]string{"event": "challenge", "api_key": k.publicKey}); err != nil {
+		return "", fmt.Errorf("can't write to websocket: %w", err)
+	}
+	for i := 0; i < challengeReadLimit; i++ {
+		h := header{}
+		if err := conn.ReadJSON(&h); err != nil {
+			return "", fmt.Errorf("can't read challenge: %w", err)
+		}
+		switch h.Event {
+		case "challenge":
+			return h.Message, nil
+		case "error":
+			return "", fmt.Errorf("challenge error: %s", h.Message)
+		}
+	}
+	return "", errors.New("no challenge received")
+}
+
+// Subscribe streams the ticker feed of the products, it closes the previous subscription
+func (k *KrakenAPI) Subscribe(productIDs ...string) (<-chan domain.Ticker, error) {
+	stream, err := k.OpenStream(Subscription{Feed: domain.TickerFeed, ProductIDs: productIDs})
+	if err != nil {
+		return nil, err
 	}
+	k.mu.Lock()
+	previous := k.stream
+	k.stream = stream
+	k.mu.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			log.Warning("close previous subscription: ", err)
+		}
+	}
+	out := make(chan domain.Ticker)
 	go func() {
 		defer close(out)
-		for {
-			_, message, err := k.conn.ReadMessage()
-			if err != nil {
-				if k.closed {
-					log.Info("normal termination")
+		for msg := range stream.Messages() {
+			if ticker, ok := msg.(domain.Ticker); ok {
+				// the consumer may stop reading after the stream is closed
+				select {
+				case out <- ticker:
+				case <-stream.done:
 					return
-				} else {
-					log.Warningf("websocket: retry to connect")
-					if err := ConnectAndSendMsg(msg); err != nil {
-						log.Error(err)
-						return
-					}
 				}
 			}
-			ticker := domain.Ticker{}
-			err = json.Unmarshal(message, &ticker)
-			if err != nil {
-				log.Info("websocket: ", err)
-				return
-			}
-			out <- ticker
 		}
 	}()
 	return out, nil
 }
 
 func (k *KrakenAPI) Unsubscribe() error {
-	k.closed = true
-	err := k.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-	return err
+	k.mu.Lock()
+	stream := k.stream
+	k.stream = nil
+	k.mu.Unlock()
+	if stream == nil {
+		return nil
+	}
+	return stream.Close()
 }
@@ -0,0 +1,329 @@
+package krakensim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/krakenapi"
+	"bot/simulator"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Server mimics the Kraken Futures REST endpoints, the ticker WebSocket feed and
+// the private fills and open_positions feeds used by krakenapi. Orders are filled
+// by simulator.Exchange.
+type Server struct {
+	exchange   *simulator.Exchange
+	publicKey  string
+	privateKey string
+	upgrader   websocket.Upgrader
+	clientsMu  sync.Mutex
+	clients    map[*client]struct{}
+}
+
+type client struct {
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	products  map[string]bool
+	feeds     map[string]bool // private feeds
+	challenge string
+}
+
+func New(exchange *simulator.Exchange, publicKey string, privateKey string) *Server {
+	s := &Server{
+		exchange:   exchange,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		clients:    make(map[*client]struct{}),
+	}
+	// fills of resting orders
+	exchange.SetFillHandler(func(fills []domain.Fill) {
+		s.broadcastPrivate(domain.FillsFeed, domain.Fills{Feed: domain.FillsFeed, Fills: fills})
+		s.broadcastPrivate(domain.OpenPositionsFeed, s.openPositionsMessage())
+	})
+	return s
+}
+
+// Routes serves the rest api under /derivatives and the feed under /ws/v1,
+// the same paths as on demo-futures.kraken.com
+func (s *Server) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Route("/derivatives", func(r chi.Router) {
+		r.Post(krakenapi.SendOrderPath, s.private(krakenapi.SendOrderPath, s.sendOrder))
+		r.Post(krakenapi.CancelOrderPath, s.private(krakenapi.CancelOrderPath, s.cancelOrder))
+		r.Post(krakenapi.CancelOrdersPath, s.private(krakenapi.CancelOrdersPath, s.cancelOrders))
+		r.Get(krakenapi.OpenPositionsPath, s.private(krakenapi.OpenPositionsPath, s.openPositions))
+	})
+	r.Get("/ws/v1", s.feed)
+	return r
+}
+
+// Broadcast updates the simulated market and sends the ticker to subscribed clients
+func (s *Server) Broadcast(ticker domain.Ticker) {
+	s.exchange.SetQuote(ticker)
+	ticker.Feed = domain.TickerFeed
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	for c := range s.clients {
+		c.mu.Lock()
+		if c.products[ticker.ProductId] {
+			if err := c.conn.WriteJSON(ticker); err != nil {
+				log.Warning("krakensim: ", err)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// broadcastPrivate sends the message to clients subscribed to the private feed
+func (s *Server) broadcastPrivate(feed string, v interface{}) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	for c := range s.clients {
+		c.mu.Lock()
+		if c.feeds[feed] {
+			if err := c.conn.WriteJSON(v); err != nil {
+				log.Warning("krakensim: ", err)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// private checks APIKey and Authent headers the same way Kraken does
+func (s *Server) private(endpointPath string, next func(w http.ResponseWriter, params map[string]string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postData, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("APIKey") != s.publicKey ||
+			!krakenapi.CheckSign(postData, []byte(endpointPath), s.privateKey, r.Header.Get("Authent")) {
+			writeJSON(w, errorResponse("authenticationError"))
+			return
+		}
+		// krakenapi sends parameters both in the query and in the body
+		values, err := url.ParseQuery(string(postData))
+		if err != nil {
+			writeJSON(w, errorResponse("invalidArgument"))
+			return
+		}
+		params := make(map[string]string)
+		for key := range r.URL.Query() {
+			params[key] = r.URL.Query().Get(key)
+		}
+		for key := range values {
+			params[key] = values.Get(key)
+		}
+		next(w, params)
+	}
+}
+
+func (s *Server) sendOrder(w http.ResponseWriter, params map[string]string) {
+	price, err := strconv.ParseFloat(params["limitPrice"], 64)
+	if err != nil && params["orderType"] != string(domain.MktType) {
+		writeJSON(w, errorResponse("invalidArgument: limitPrice"))
+		return
+	}
+	size, err := strconv.ParseInt(params["size"], 10, 64)
+	if err != nil {
+		writeJSON(w, errorResponse("invalidArgument: size"))
+		return
+	}
+	side := domain.Action(params["side"])
+	if side != domain.Buy && side != domain.Sell {
+		writeJSON(w, errorResponse("invalidArgument: side"))
+		return
+	}
+	order := domain.NewOrder(params["symbol"], side, domain.OrderType(params["orderType"]), price, size)
+	resp, err := s.exchange.SendOrder(context.Background(), *order)
+	if errors.Is(err, simulator.ErrNoQuote) {
+		resp = &domain.SendOrderResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}
+		resp.SendStatus.Status = simulator.StatusMarketSuspended
+	} else if err != nil {
+		writeJSON(w, errorResponse(err.Error()))
+		return
+	}
+	writeJSON(w, resp)
+	if fills := executions(resp); len(fills) > 0 {
+		s.broadcastPrivate(domain.FillsFeed, domain.Fills{Feed: domain.FillsFeed, Fills: fills})
+		s.broadcastPrivate(domain.OpenPositionsFeed, s.openPositionsMessage())
+	}
+}
+
+func executions(resp *domain.SendOrderResponse) []domain.Fill {
+	var fills []domain.Fill
+	for _, event := range resp.SendStatus.OrderEvents {
+		if event.Type != domain.ExecutionEvent {
+			continue
+		}
+		order := event.OrderInfo()
+		fills = append(fills, domain.Fill{
+			Instrument: order.Symbol,
+			Time:       time.Now().UnixNano() / int64(time.Millisecond),
+			Price:      event.Price,
+			Buy:        order.Side == domain.Buy,
+			Qty:        float64(event.Amount),
+			OrderID:    resp.SendStatus.OrderID,
+			FillID:     event.ExecutionID,
+			FillType:   "taker",
+		})
+	}
+	return fills
+}
+
+func (s *Server) openPositionsMessage() domain.OpenPositions {
+	msg := domain.OpenPositions{Feed: domain.OpenPositionsFeed, Positions: []domain.OpenPosition{}}
+	resp, err := s.exchange.GetPositions(context.Background())
+	if err != nil {
+		return msg
+	}
+	for _, position := range resp.OpenPositions {
+		balance := float64(position.Size)
+		if position.Side == "short" {
+			balance = -balance
+		}
+		msg.Positions = append(msg.Positions, domain.OpenPosition{
+			Instrument: position.Symbol,
+			Balance:    balance,
+			EntryPrice: position.Price,
+		})
+	}
+	return msg
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, params map[string]string) {
+	resp, err := s.exchange.CancelOrder(context.Background(), params["order_id"])
+	if err != nil {
+		writeJSON(w, errorResponse(err.Error()))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) cancelOrders(w http.ResponseWriter, params map[string]string) {
+	resp, err := s.exchange.CancelOrders(context.Background())
+	if err != nil {
+		writeJSON(w, errorResponse(err.Error()))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) openPositions(w http.ResponseWriter, params map[string]string) {
+	resp, err := s.exchange.GetPositions(context.Background())
+	if err != nil {
+		writeJSON(w, errorResponse(err.Error()))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) feed(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warning("krakensim: ", err)
+		return
+	}
+	c := &client{conn: conn, products: make(map[string]bool), feeds: make(map[string]bool)}
+	c.send(map[string]interface{}{"event": "info", "version": 1})
+	s.clientsMu.Lock()
+	s.clients[c] = struct{}{}
+	s.clientsMu.Unlock()
+	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, c)
+		s.clientsMu.Unlock()
+		conn.Close()
+	}()
+	for {
+		msg := domain.Message{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch {
+		case msg.Event == "challenge":
+			s.sendChallenge(c, msg)
+		case msg.Feed == domain.TickerFeed:
+			c.mu.Lock()
+			for _, product := range msg.ProductIDs {
+				c.products[product] = msg.Event == "subscribe"
+			}
+			c.mu.Unlock()
+			c.send(domain.Message{Event: msg.Event + "d", Feed: msg.Feed, ProductIDs: msg.ProductIDs})
+		case msg.Feed == domain.FillsFeed || msg.Feed == domain.OpenPositionsFeed:
+			s.subscribePrivate(c, msg)
+		default:
+			c.send(map[string]interface{}{"event": "error", "message": "Invalid feed"})
+		}
+	}
+}
+
+func (s *Server) sendChallenge(c *client, msg domain.Message) {
+	if msg.APIKey != s.publicKey {
+		c.send(map[string]interface{}{"event": "error", "message": "Invalid api key"})
+		return
+	}
+	challenge := domain.NewID()
+	c.mu.Lock()
+	c.challenge = challenge
+	c.mu.Unlock()
+	c.send(map[string]interface{}{"event": "challenge", "message": challenge})
+}
+
+// subscribePrivate checks the signed challenge and sends the feed snapshot
+func (s *Server) subscribePrivate(c *client, msg domain.Message) {
+	c.mu.Lock()
+	challenge := c.challenge
+	c.mu.Unlock()
+	if msg.APIKey != s.publicKey || challenge == "" || msg.OriginalChallenge != challenge ||
+		!krakenapi.CheckSign([]byte(challenge), nil, s.privateKey, msg.SignedChallenge) {
+		c.send(map[string]interface{}{"event": "error", "message": "Invalid challenge"})
+		return
+	}
+	c.mu.Lock()
+	c.feeds[msg.Feed] = msg.Event == "subscribe"
+	c.mu.Unlock()
+	c.send(domain.Message{Event: msg.Event + "d", Feed: msg.Feed})
+	if msg.Event != "subscribe" {
+		return
+	}
+	if msg.Feed == domain.FillsFeed {
+		c.send(domain.Fills{Feed: domain.FillsSnapshotFeed, Fills: []domain.Fill{}})
+	} else {
+		c.send(s.openPositionsMessage())
+	}
+}
+
+func (c *client) send(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.conn.WriteJSON(v); err != nil {
+		log.Warning("krakensim: ", err)
+	}
+}
+
+func errorResponse(text string) domain.BaseResponse {
+	return domain.BaseResponse{Result: domain.Error, Error: &text}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
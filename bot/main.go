@@ -1,46 +1,74 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	// not-std
+	"bot/backtest"
+	"bot/domain"
+	"bot/features"
 	"bot/handlers"
 	"bot/krakenapi"
 	"bot/modelapi"
+	"bot/orderbook"
+	"bot/recorder"
 	"bot/repository"
 	"bot/service"
+	"bot/simulator"
 	"bot/telegramapi"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 var dsn string
 var telegramToken string
-var modelServiceURL string
+var modelConfig string // model service url or composite model config
 var krakenapiConfig krakenapi.Config
 var botConfig service.Parameters
+var backtestTapePath string
+var paperTrading bool
+var recordDir string
+var useOrderBook bool
+var cancelOrdersOnExit bool
+var shutdownTimeout time.Duration
 
 func init() {
 	dsnPath := flag.String("dsn_path", "", "path to dsn")
 	krakenConfigPath := flag.String("kraken_config_path", "", "path to yaml file with kraken config")
 	telegramCredsPath := flag.String("telegram_creds_path", "", "path to file with telegram bot token")
-	modelConfigPath := flag.String("model_config_path", "", "path to file with model service url")
+	modelConfigPath := flag.String("model_config_path", "", "path to file with model service url or yaml config of several models")
 	botConfigPath := flag.String("bot_config_path", "", "path to yaml file with bot parameters")
+	flag.StringVar(&backtestTapePath, "backtest_tape_path", "", "path to recorded tickers file or directory, runs backtest instead of trading")
+	flag.StringVar(&recordDir, "record_dir", "", "directory to record received tickers to")
+	flag.BoolVar(&useOrderBook, "order_book", false, "price orders by the depth of the local order book built from the book feed")
+	flag.BoolVar(&cancelOrdersOnExit, "cancel_orders_on_exit", false, "cancel resting orders on kraken when the bot exits")
+	flag.DurationVar(&shutdownTimeout, "shutdown_timeout", 15*time.Second, "deadline of the graceful shutdown")
+	flag.BoolVar(&paperTrading, "paper", false, "paper trading: live tickers, orders are filled by the simulator")
 	flag.Parse()
 	data, err := os.ReadFile(*dsnPath)
 	dsn = string(data)
 	data, err = os.ReadFile(*telegramCredsPath)
 	telegramToken = string(data)
 	data, err = os.ReadFile(*modelConfigPath)
-	modelServiceURL = string(data)
+	modelConfig = string(data)
 	data, err = os.ReadFile(*botConfigPath)
 	err = yaml.Unmarshal(data, &botConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := botConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	data, err = os.ReadFile(*krakenConfigPath)
 	err = yaml.Unmarshal(data, &krakenapiConfig)
 	if err != nil {
@@ -49,6 +77,12 @@ func init() {
 }
 
 func main() {
+	if backtestTapePath != "" {
+		runBacktest()
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	// repository
 	pool, err := repository.NewPool(dsn)
 	if err != nil {
@@ -56,6 +90,9 @@ func main() {
 	}
 	defer pool.Close()
 	repo := repository.New(pool)
+	if paperTrading {
+		repo = repository.NewPaper(pool)
+	}
 
 	// notifier
 	telegramNotifier, err := telegramapi.NewWithCreds(telegramToken)
@@ -64,17 +101,157 @@ func main() {
 	}
 
 	// model service
-	modelService := modelapi.New(modelServiceURL)
+	modelService, err := modelapi.NewFromConfig(modelConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// kraken api
 	krakenAPI := krakenapi.NewWithConfig(krakenapiConfig)
+	var exchangeAPI service.ExchangeAPI = krakenAPI
+	if recordDir != "" {
+		tickerRecorder, err := recorder.New(recorder.Config{Dir: recordDir})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer tickerRecorder.Close()
+		exchangeAPI = recorder.Tee(exchangeAPI, tickerRecorder)
+	}
+	var paperExchange *simulator.PaperExchange
+	if paperTrading {
+		log.Info("paper trading mode")
+		paperExchange = simulator.NewPaper(exchangeAPI)
+		exchangeAPI = paperExchange
+		telegramNotifier.SetTag("PAPER")
+	}
 
 	// service
-	tradeBot := service.New(krakenAPI, telegramNotifier, repo, modelService, botConfig)
+	tradeBot := service.New(exchangeAPI, telegramNotifier, repo, modelService, botConfig)
+	for instrument, model := range instrumentModels() {
+		tradeBot.SetModel(instrument, model)
+	}
+	tradeBot.SetModelFactory(func(url string) service.Predictor {
+		return modelapi.NewWithPipeline(url, modelPipeline())
+	})
+	tradeBot.WatchConnection(krakenAPI.ConnectionEvents())
+	// fills of resting orders
+	if paperExchange != nil {
+		paperExchange.SetFillHandler(tradeBot.OnFills)
+	} else {
+		go followFills(ctx, krakenAPI, tradeBot)
+	}
+	if useOrderBook {
+		books := orderbook.New()
+		go func() {
+			if err := books.Follow(ctx, krakenAPI, botConfig.InstrumentIDs()...); err != nil {
+				log.Error("order book: ", err)
+			}
+		}()
+		tradeBot.SetOrderBook(books)
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
-	tradebotHandler := handlers.New(tradeBot)
+	tradebotHandler := handlers.New(tradeBot, repo)
+	r.Handle("/metrics", promhttp.Handler())
 	r.Mount("/", tradebotHandler.Routes())
-	log.Fatal(http.ListenAndServe(":3000", r))
+	server := &http.Server{Addr: ":3000", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Info("shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// no more api calls, so the bot can't be started again
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("http server shutdown: ", err)
+	}
+	if err := tradeBot.Stop(shutdownCtx); err != nil && !errors.Is(err, service.ErrInvalidState) {
+		log.Error("bot stop: ", err)
+	}
+	if cancelOrdersOnExit && !paperTrading {
+		resp, err := krakenAPI.CancelOrders(shutdownCtx)
+		switch {
+		case err != nil:
+			log.Error("cancel orders: ", err)
+		case resp.Result != domain.Success:
+			log.Error("cancel orders: ", *resp.Error)
+		default:
+			log.Info("orders canceled: ", resp.CancelStatus.Status)
+		}
+	}
+	if err := telegramNotifier.Flush(shutdownCtx); err != nil {
+		log.Error("notifications flush: ", err)
+	}
+	// the recorder and the pool are closed by defers
+	log.Info("bye")
+}
+
+// followFills passes the fills feed to the bot until ctx is done
+func followFills(ctx context.Context, api *krakenapi.KrakenAPI, tradeBot *service.Bot) {
+	stream, err := api.OpenStream(krakenapi.Subscription{Feed: domain.FillsFeed})
+	if err != nil {
+		log.Error("fills feed: ", err)
+		return
+	}
+	defer stream.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-stream.Messages():
+			if !ok {
+				return
+			}
+			// the snapshot holds fills made before the start
+			if fills, ok := msg.(domain.Fills); ok && fills.Feed == domain.FillsFeed {
+				tradeBot.OnFills(fills.Fills)
+			}
+		}
+	}
+}
+
+func runBacktest() {
+	tape, err := recorder.ReadPath(backtestTapePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelService, err := modelapi.NewFromConfig(modelConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report, err := backtest.Run(tape, modelService, instrumentModels(), botConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(report)
+}
+
+// instrumentModels returns model services of instruments with their own model_url
+func instrumentModels() map[string]service.Predictor {
+	models := make(map[string]service.Predictor)
+	for _, inst := range botConfig.InstrumentList() {
+		if inst.ModelURL != "" {
+			models[inst.Instrument] = modelapi.NewWithPipeline(inst.ModelURL, modelPipeline())
+		}
+	}
+	return models
+}
+
+// modelPipeline returns the features of the model config, models of instruments use them too
+func modelPipeline() *features.Pipeline {
+	config, err := modelapi.ParseConfig(modelConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pipeline, err := config.Pipeline()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pipeline
 }
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	// not-std
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "tradebot"
+
+var (
+	TickersReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tickers_received_total",
+		Help:      "Tickers received from the exchange feed.",
+	}, []string{"instrument"})
+
+	WebSocketReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_reconnects_total",
+		Help:      "Reconnection attempts of the exchange WebSocket.",
+	})
+
+	WebSocketConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connected",
+		Help:      "1 if the exchange WebSocket of the feeds is connected.",
+	}, []string{"feeds"})
+
+	PredictDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "predict_duration_seconds",
+		Help:      "Latency of model predictions.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+
+	PredictErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "predict_errors_total",
+		Help:      "Failed model predictions.",
+	})
+
+	PredictedValue = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "predicted_value",
+		Help:      "Distribution of predicted values.",
+		Buckets:   prometheus.LinearBuckets(0.1, 0.1, 9),
+	}, []string{"instrument"})
+
+	ModelFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_fallbacks_total",
+		Help:      "Predictions of the fallback model or neutral ones made when the models failed.",
+	}, []string{"model"})
+
+	PredictionSources = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prediction_sources_total",
+		Help:      "Decisions by the models that produced the prediction.",
+	}, []string{"instrument", "model"})
+
+	SequencesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sequences_dropped_total",
+		Help:      "Sequences replaced by newer ones while waiting for the processing.",
+	}, []string{"instrument"})
+
+	OrdersSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_sent_total",
+		Help:      "Orders sent to the exchange.",
+	}, []string{"instrument", "side"})
+
+	OrdersFilled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_filled_total",
+		Help:      "Orders with at least one execution.",
+	}, []string{"instrument", "side"})
+
+	OrdersRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_rejected_total",
+		Help:      "Orders failed or rejected without executions.",
+	}, []string{"instrument", "reason"})
+
+	NotificationDrops = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_queue_drops_total",
+		Help:      "Notifications dropped because the job queue is full.",
+	})
+
+	RiskVetoes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "risk_vetoes_total",
+		Help:      "Orders vetoed or reduced by risk checks.",
+	}, []string{"instrument", "check"})
+
+	StorageFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_insert_failures_total",
+		Help:      "Failed inserts of order events to the repository.",
+	})
+)
@@ -0,0 +1,58 @@
+#!/usr/bin/env python
+# coding: utf-8
+
+# Exports the weights of the saved model for the in-process inference of the bot
+# (package inference) with samples of the model outputs to validate the export:
+#   python export_weights.py model/1/ model.json
+
+import json
+import sys
+
+import numpy as np
+import tensorflow as tf
+from tensorflow import keras
+import keras.layers as layers
+
+
+def export_layer(layer):
+    weights = [w.tolist() for w in layer.get_weights()]
+    if isinstance(layer, layers.BatchNormalization):
+        if not layer.scale or not layer.center:
+            raise ValueError("batch normalization must have scale and center")
+        gamma, beta, moving_mean, moving_variance = weights
+        return {"type": "batch_normalization", "gamma": gamma, "beta": beta,
+                "moving_mean": moving_mean, "moving_variance": moving_variance,
+                "epsilon": float(layer.epsilon)}
+    if isinstance(layer, layers.LSTM):
+        if layer.activation.__name__ != "tanh" or layer.recurrent_activation.__name__ != "sigmoid":
+            raise ValueError("lstm must use tanh and sigmoid activations")
+        if not layer.use_bias:
+            raise ValueError("lstm must use bias")
+        kernel, recurrent_kernel, bias = weights
+        return {"type": "lstm", "kernel": kernel, "recurrent_kernel": recurrent_kernel,
+                "bias": bias, "return_sequences": layer.return_sequences}
+    if isinstance(layer, layers.Dense):
+        if not layer.use_bias:
+            raise ValueError("dense must use bias")
+        kernel, bias = weights
+        return {"type": "dense", "kernel": kernel, "bias": bias,
+                "activation": layer.activation.__name__}
+    raise ValueError("unsupported layer %s" % layer.name)
+
+
+def main(model_path, out_path, samples=20, sequence_length=10):
+    model = keras.models.load_model(model_path)
+    input_size = model.input_shape[-1]
+    x = np.random.normal(size=(samples, sequence_length, input_size))
+    y = model.predict(x)
+    export = {
+        "input_size": input_size,
+        "layers": [export_layer(layer) for layer in model.layers],
+        "samples": [{"input": x[i].tolist(), "output": float(y[i][0])} for i in range(samples)],
+    }
+    with open(out_path, "w") as f:
+        json.dump(export, f)
+
+
+if __name__ == "__main__":
+    main(sys.argv[1], sys.argv[2])
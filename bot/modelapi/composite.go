@@ -0,0 +1,322 @@
+package modelapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/features"
+	"bot/metrics"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Ways to combine predictions of the models
+const (
+	CombineAverage  = "average"
+	CombineWeighted = "weighted"
+	CombineVote     = "vote"
+)
+
+// Neutral is the prediction that makes no decision
+const Neutral = 0.5
+
+// NeutralSource is reported as the source of the neutral prediction
+const NeutralSource = "neutral"
+
+var ErrNoModels = errors.New("not enough models answered")
+
+// ErrZeroWeight is returned when the weights of the answered models sum to 0
+var ErrZeroWeight = errors.New("zero total weight of the answered models")
+
+type Predictor interface {
+	Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error)
+}
+
+// Config of the models, see ParseConfig
+type Config struct {
+	Models           []ModelConfig      `yaml:"models"`
+	Features         []features.Feature `yaml:"features"`           // input of all models, raw ticker fields if empty
+	Combine          string             `yaml:"combine"`            // average if empty
+	MinModels        int                `yaml:"min_models"`         // answers needed to combine, 1 if 0
+	Timeout          string             `yaml:"timeout"`            // per model, the call deadline if empty
+	Fallback         *ModelConfig       `yaml:"fallback"`           // used if the models fail
+	NeutralOnFailure bool               `yaml:"neutral_on_failure"` // 0.5 if the fallback fails too
+}
+
+// ModelConfig is the HTTP model of the url, the gRPC model or the local model file
+type ModelConfig struct {
+	Name     string      `yaml:"name"` // url, grpc address/model_name or file if empty
+	URL      string      `yaml:"url"`
+	GRPC     *GRPCConfig `yaml:"grpc"`
+	File     string      `yaml:"file"`      // weights exported by export_weights.py
+	MaxError float64     `yaml:"max_error"` // of the file model on the exported samples, DefaultMaxError if 0
+	Weight   *float64    `yaml:"weight"`    // 1 if not set, 0 disables the model in weighted combine
+}
+
+// Member is a model of the composite
+type Member struct {
+	Name      string
+	Predictor Predictor
+	Weight    float64
+}
+
+// Composite queries several models in parallel and combines their predictions,
+// falls back to the fallback model or the neutral prediction on failure
+type Composite struct {
+	Members          []Member
+	Combine          string
+	MinModels        int
+	Timeout          time.Duration // per model, 0 uses the call deadline
+	Fallback         *Member
+	NeutralOnFailure bool
+}
+
+// ParseConfig parses the model config file: a single url
+// or the yaml config of the features and the composite model
+func ParseConfig(data string) (Config, error) {
+	data = strings.TrimSpace(data)
+	if !strings.Contains(data, "\n") && (strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://")) {
+		return Config{Models: []ModelConfig{{URL: data}}}, nil
+	}
+	var config Config
+	err := yaml.Unmarshal([]byte(data), &config)
+	return config, err
+}
+
+// Pipeline returns the feature pipeline of the models
+func (c Config) Pipeline() (*features.Pipeline, error) {
+	return features.New(c.Features)
+}
+
+// NewFromConfig returns the model of the model config file, see ParseConfig
+func NewFromConfig(data string) (Predictor, error) {
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Models) == 1 && config.Fallback == nil {
+		pipeline, err := config.Pipeline()
+		if err != nil {
+			return nil, err
+		}
+		member, err := config.Models[0].member(pipeline)
+		if err != nil {
+			return nil, err
+		}
+		return member.Predictor, nil
+	}
+	return NewComposite(config)
+}
+
+// NewComposite returns the composite of the models of the config
+func NewComposite(config Config) (*Composite, error) {
+	if len(config.Models) == 0 {
+		return nil, errors.New("no models in the model config")
+	}
+	pipeline, err := config.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	composite := &Composite{
+		Combine:          config.Combine,
+		MinModels:        config.MinModels,
+		NeutralOnFailure: config.NeutralOnFailure,
+	}
+	switch config.Combine {
+	case "", CombineAverage, CombineWeighted, CombineVote:
+	default:
+		return nil, fmt.Errorf("unknown combine %q", config.Combine)
+	}
+	if config.MinModels > len(config.Models) {
+		return nil, fmt.Errorf("min_models %d is more than the models", config.MinModels)
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		composite.Timeout = timeout
+	}
+	for i, model := range config.Models {
+		if model.Weight != nil && *model.Weight < 0 {
+			return nil, fmt.Errorf("models[%d]: negative weight %v", i, *model.Weight)
+		}
+		member, err := model.member(pipeline)
+		if err != nil {
+			return nil, err
+		}
+		composite.Members = append(composite.Members, member)
+	}
+	if config.Fallback != nil {
+		fallback, err := config.Fallback.member(pipeline)
+		if err != nil {
+			return nil, err
+		}
+		composite.Fallback = &fallback
+	}
+	return composite, nil
+}
+
+func (c ModelConfig) member(pipeline *features.Pipeline) (Member, error) {
+	member := Member{Name: c.Name, Weight: 1}
+	if c.Weight != nil {
+		member.Weight = *c.Weight
+	}
+	switch {
+	case c.GRPC != nil:
+		if member.Name == "" {
+			member.Name = c.GRPC.Address + "/" + c.GRPC.ModelName
+		}
+		model, err := NewGRPC(*c.GRPC, pipeline)
+		member.Predictor = model
+		return member, err
+	case c.File != "":
+		if member.Name == "" {
+			member.Name = c.File
+		}
+		model, err := NewLocal(c.File, c.MaxError, pipeline)
+		member.Predictor = model
+		return member, err
+	}
+	if member.Name == "" {
+		member.Name = c.URL
+	}
+	member.Predictor = NewWithPipeline(c.URL, pipeline)
+	return member, nil
+}
+
+// Predict returns the combined prediction
+func (c *Composite) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	value, _, err := c.PredictWithSource(ctx, tickers...)
+	return value, err
+}
+
+type answer struct {
+	member Member
+	value  float64
+	err    error
+}
+
+// PredictWithSource returns the combined prediction and the models it's made of:
+// the names of the answered models joined by "+", the fallback name or NeutralSource
+func (c *Composite) PredictWithSource(ctx context.Context, tickers ...domain.Ticker) (float64, string, error) {
+	answers := make([]answer, len(c.Members))
+	var wg sync.WaitGroup
+	for i, member := range c.Members {
+		wg.Add(1)
+		go func(i int, member Member) {
+			defer wg.Done()
+			value, err := c.predict(ctx, member, tickers)
+			answers[i] = answer{member: member, value: value, err: err}
+		}(i, member)
+	}
+	wg.Wait()
+	answered := make([]answer, 0, len(answers))
+	for _, a := range answers {
+		if a.err != nil {
+			log.Warningf("model %s: %v", a.member.Name, a.err)
+			continue
+		}
+		answered = append(answered, a)
+	}
+	minModels := c.MinModels
+	if minModels == 0 {
+		minModels = 1
+	}
+	if len(answered) >= minModels {
+		names := make([]string, 0, len(answered))
+		for _, a := range answered {
+			names = append(names, a.member.Name)
+		}
+		value, err := c.combine(answered)
+		if err == nil {
+			return value, strings.Join(names, "+"), nil
+		}
+		return c.fail(ctx, tickers, err)
+	}
+	return c.fail(ctx, tickers, fmt.Errorf("%w: %d of %d", ErrNoModels, len(answered), len(c.Members)))
+}
+
+// fail falls back to the fallback model or the neutral prediction
+func (c *Composite) fail(ctx context.Context, tickers []domain.Ticker, err error) (float64, string, error) {
+	if ctx.Err() != nil {
+		// canceled, not a failure of the models
+		return 0, "", ctx.Err()
+	}
+	if c.Fallback != nil {
+		metrics.ModelFallbacks.WithLabelValues(c.Fallback.Name).Inc()
+		value, fallbackErr := c.predict(ctx, *c.Fallback, tickers)
+		if fallbackErr == nil {
+			log.Warningf("%v, fallback model %s is used", err, c.Fallback.Name)
+			return value, c.Fallback.Name, nil
+		}
+		err = fmt.Errorf("%w, fallback model %s: %v", err, c.Fallback.Name, fallbackErr)
+	}
+	if c.NeutralOnFailure && ctx.Err() == nil {
+		metrics.ModelFallbacks.WithLabelValues(NeutralSource).Inc()
+		log.Warningf("%v, neutral prediction is used", err)
+		return Neutral, NeutralSource, nil
+	}
+	return 0, "", err
+}
+
+func (c *Composite) predict(ctx context.Context, member Member, tickers []domain.Ticker) (float64, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return member.Predictor.Predict(ctx, tickers...)
+}
+
+// combine must be called with at least one answer
+func (c *Composite) combine(answers []answer) (float64, error) {
+	switch c.Combine {
+	case CombineWeighted:
+		var sum, weights float64
+		for _, a := range answers {
+			sum += a.value * a.member.Weight
+			weights += a.member.Weight
+		}
+		if weights <= 0 {
+			return 0, ErrZeroWeight
+		}
+		return sum / weights, nil
+	case CombineVote:
+		// average of the majority side, neutral on a tie
+		var up, down []float64
+		for _, a := range answers {
+			switch {
+			case a.value > Neutral:
+				up = append(up, a.value)
+			case a.value < Neutral:
+				down = append(down, a.value)
+			}
+		}
+		switch {
+		case len(up) > len(down):
+			return average(up), nil
+		case len(down) > len(up):
+			return average(down), nil
+		}
+		return Neutral, nil
+	}
+	values := make([]float64, 0, len(answers))
+	for _, a := range answers {
+		values = append(values, a.value)
+	}
+	return average(values), nil
+}
+
+func average(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,130 @@
+package modelapi
+
+import (
+	"bot/domain"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type stubModel struct {
+	value float64
+	err   error
+	delay time.Duration
+}
+
+func (m stubModel) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	select {
+	case <-time.After(m.delay):
+		return m.value, m.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestComposite_Combine(t *testing.T) {
+	composite := &Composite{Members: []Member{
+		{Name: "a", Predictor: stubModel{value: 0.9}, Weight: 3},
+		{Name: "b", Predictor: stubModel{value: 0.7}, Weight: 1},
+		{Name: "c", Predictor: stubModel{value: 0.2}, Weight: 1},
+	}}
+	value, source, err := composite.PredictWithSource(context.Background())
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.6, value, 1e-9)
+	assert.Equal(t, "a+b+c", source)
+
+	composite.Combine = CombineWeighted
+	value, _, _ = composite.PredictWithSource(context.Background())
+	assert.InDelta(t, 0.72, value, 1e-9)
+
+	composite.Combine = CombineVote
+	value, _, _ = composite.PredictWithSource(context.Background())
+	assert.InDelta(t, 0.8, value, 1e-9)
+
+	// only zero weight models answered
+	composite.Combine = CombineWeighted
+	composite.Members = []Member{{Name: "a", Predictor: stubModel{value: 0.9}}}
+	_, _, err = composite.PredictWithSource(context.Background())
+	assert.ErrorIs(t, err, ErrZeroWeight)
+}
+
+func TestComposite_Fallback(t *testing.T) {
+	composite := &Composite{
+		Members: []Member{
+			{Name: "slow", Predictor: stubModel{value: 0.9, delay: time.Second}},
+			{Name: "down", Predictor: stubModel{err: errors.New("connection refused")}},
+		},
+		Timeout:  10 * time.Millisecond,
+		Fallback: &Member{Name: "backup", Predictor: stubModel{value: 0.3}},
+	}
+	value, source, err := composite.PredictWithSource(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0.3, value)
+	assert.Equal(t, "backup", source)
+
+	composite.Fallback.Predictor = stubModel{err: errors.New("connection refused")}
+	_, _, err = composite.PredictWithSource(context.Background())
+	assert.ErrorIs(t, err, ErrNoModels)
+
+	composite.NeutralOnFailure = true
+	value, source, err = composite.PredictWithSource(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Neutral, value)
+	assert.Equal(t, NeutralSource, source)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	model, err := NewFromConfig("http://localhost:7070/v1/models/trade_model:predict\n")
+	assert.Nil(t, err)
+	assert.IsType(t, &ModelService{}, model)
+
+	model, err = NewFromConfig(`
+models:
+  - name: v1
+    url: http://localhost:7070/v1/models/trade_model/versions/1:predict
+  - url: http://localhost:7070/v1/models/trade_model/versions/2:predict
+    weight: 2
+combine: weighted
+timeout: 2s
+neutral_on_failure: true
+`)
+	assert.Nil(t, err)
+	composite := model.(*Composite)
+	assert.Equal(t, "v1", composite.Members[0].Name)
+	assert.Equal(t, 2.0, composite.Members[1].Weight)
+	assert.Equal(t, 2*time.Second, composite.Timeout)
+
+	_, err = NewFromConfig("models: []")
+	assert.NotNil(t, err)
+	_, err = NewFromConfig("models:\n  - url: http://a\n  - url: http://b\n    weight: -1\n")
+	assert.NotNil(t, err)
+
+	// weight 0 disables the model, unset weight is 1
+	model, err = NewFromConfig("models:\n  - url: http://a\n  - url: http://b\n    weight: 0\n")
+	assert.Nil(t, err)
+	composite = model.(*Composite)
+	assert.Equal(t, 1.0, composite.Members[0].Weight)
+	assert.Equal(t, 0.0, composite.Members[1].Weight)
+}
+
+func TestNewFromConfig_File(t *testing.T) {
+	model, err := NewFromConfig(`
+features:
+  - name: field
+    field: bid
+  - name: field
+    field: ask
+models:
+  - file: ../inference/testdata/model.json
+`)
+	assert.Nil(t, err)
+	value, err := model.Predict(context.Background(), domain.Ticker{Bid: 2, Ask: 1}, domain.Ticker{Bid: 0, Ask: -1}, domain.Ticker{Bid: 1, Ask: 0.5})
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.27404406513392665, value, 1e-12)
+
+	// the raw ticker fields don't match the model input
+	_, err = NewFromConfig("models:\n  - file: ../inference/testdata/model.json\n")
+	assert.NotNil(t, err)
+}
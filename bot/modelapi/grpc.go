@@ -0,0 +1,83 @@
+package modelapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/features"
+	"bot/tfserving"
+)
+
+// GRPCConfig selects the model of the TF Serving gRPC endpoint
+type GRPCConfig struct {
+	Address   string `yaml:"address"` // host:port, 8500 is the TF Serving gRPC port
+	ModelName string `yaml:"model_name"`
+	Version   int64  `yaml:"version"`   // latest if 0
+	Signature string `yaml:"signature"` // DefaultSignatureName if empty
+	Input     string `yaml:"input"`     // name of the input tensor of the signature
+	Output    string `yaml:"output"`    // the only output if empty
+}
+
+// GRPCModel calls TF Serving PredictionService over a single reused connection
+type GRPCModel struct {
+	config   GRPCConfig
+	client   *tfserving.Client
+	pipeline *features.Pipeline
+}
+
+func NewGRPC(config GRPCConfig, pipeline *features.Pipeline) (*GRPCModel, error) {
+	if config.Address == "" || config.ModelName == "" || config.Input == "" {
+		return nil, fmt.Errorf("grpc model: address, model_name and input must be set")
+	}
+	if config.Signature == "" {
+		config.Signature = DefaultSignatureName
+	}
+	client, err := tfserving.Dial(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCModel{config, client, pipeline}, nil
+}
+
+// Predict calls the model, the request is canceled with ctx
+func (m *GRPCModel) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	start := time.Now()
+	value, err := m.predict(ctx, tickers)
+	observe(tickers, start, value, err)
+	return value, err
+}
+
+func (m *GRPCModel) predict(ctx context.Context, tickers []domain.Ticker) (float64, error) {
+	rows := m.pipeline.Transform(tickers)
+	input := tfserving.Tensor{Shape: []int64{1, int64(len(rows)), 0}}
+	for _, row := range rows {
+		input.Shape[2] = int64(len(row))
+		for _, v := range row {
+			input.Values = append(input.Values, float32(v))
+		}
+	}
+	resp, err := m.client.Predict(ctx, &tfserving.PredictRequest{
+		ModelSpec: tfserving.ModelSpec{Name: m.config.ModelName, Version: m.config.Version, SignatureName: m.config.Signature},
+		Inputs:    map[string]tfserving.Tensor{m.config.Input: input},
+	})
+	if err != nil {
+		return 0, err
+	}
+	output, ok := resp.Outputs[m.config.Output]
+	if m.config.Output == "" && len(resp.Outputs) == 1 {
+		for _, tensor := range resp.Outputs {
+			output, ok = tensor, true
+		}
+	}
+	if !ok || len(output.Values) == 0 {
+		return 0, ErrNoPredictions
+	}
+	return float64(output.Values[0]), nil
+}
+
+// Close closes the connection
+func (m *GRPCModel) Close() error {
+	return m.client.Close()
+}
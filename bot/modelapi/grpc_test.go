@@ -0,0 +1,40 @@
+package modelapi
+
+import (
+	"bot/domain"
+	"bot/features"
+	"bot/modelsim"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGRPCModel_Predict(t *testing.T) {
+	var received [][]float32
+	server := modelsim.New("trade_model", "input_1", func(sequence [][]float32) float32 {
+		received = sequence
+		return 0.75
+	})
+	addr, err := server.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer server.Stop()
+
+	model, err := NewGRPC(GRPCConfig{Address: addr, ModelName: "trade_model", Input: "input_1"}, features.Default())
+	assert.Nil(t, err)
+	defer model.Close()
+	tickers := []domain.Ticker{{Bid: 1, Ask: 2, Last: 1.5}, {Bid: 3, Ask: 4, Last: 3.5}}
+	// the connection is reused
+	for i := 0; i < 2; i++ {
+		value, err := model.Predict(context.Background(), tickers...)
+		assert.Nil(t, err)
+		assert.Equal(t, 0.75, value)
+	}
+	assert.Len(t, received, 2)
+	assert.Equal(t, []float32{3, 4, 0, 0, 0, 0, 3.5, 0, 0}, received[1])
+
+	unknown, err := NewGRPC(GRPCConfig{Address: addr, ModelName: "other", Input: "input_1"}, features.Default())
+	assert.Nil(t, err)
+	defer unknown.Close()
+	_, err = unknown.Predict(context.Background(), tickers...)
+	assert.NotNil(t, err)
+}
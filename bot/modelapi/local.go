@@ -0,0 +1,53 @@
+package modelapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/features"
+	"bot/inference"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMaxError is the largest allowed difference from the outputs
+// of the original model saved with the weights
+const DefaultMaxError = 1e-4
+
+// LocalModel runs the exported model in process, without TF Serving
+type LocalModel struct {
+	model    *inference.Model
+	pipeline *features.Pipeline
+}
+
+// NewLocal loads the model file and checks it on the samples saved by the export
+func NewLocal(path string, maxError float64, pipeline *features.Pipeline) (*LocalModel, error) {
+	model, err := inference.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("local model %s: %w", path, err)
+	}
+	if len(pipeline.Names()) != model.InputSize {
+		return nil, fmt.Errorf("local model %s: %d features, the model expects %d", path, len(pipeline.Names()), model.InputSize)
+	}
+	if maxError == 0 {
+		maxError = DefaultMaxError
+	}
+	diff, err := model.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("local model %s: %w", path, err)
+	}
+	if diff > maxError {
+		return nil, fmt.Errorf("local model %s: outputs differ from the original model by %g", path, diff)
+	}
+	log.Infof("local model %s: %d layers, %d samples validated, max error %g", path, len(model.Layers), len(model.Samples), diff)
+	return &LocalModel{model, pipeline}, nil
+}
+
+// Predict runs the model on the CPU, ctx is not used
+func (m *LocalModel) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	start := time.Now()
+	value, err := m.model.Predict(m.pipeline.Transform(tickers))
+	observe(tickers, start, value, err)
+	return value, err
+}
@@ -2,11 +2,17 @@ package modelapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 	// not-std
 	"bot/domain"
+	"bot/features"
+	"bot/metrics"
 )
 
 type vector []float64
@@ -22,20 +28,60 @@ type tfServeResponse struct {
 	Predictions []vector `json:"predictions"`
 }
 
+var ErrNoPredictions = errors.New("no predictions in model response")
+
 type ModelService struct {
-	url string
+	url      string
+	client   *http.Client
+	pipeline *features.Pipeline
 }
 
+// New returns the model of raw ticker fields
 func New(url string) *ModelService {
-	return &ModelService{url}
+	return NewWithPipeline(url, features.Default())
+}
+
+// NewWithPipeline returns the model of the features of the pipeline
+func NewWithPipeline(url string, pipeline *features.Pipeline) *ModelService {
+	return &ModelService{url, &http.Client{}, pipeline}
+}
+
+// Predict calls the model, the request is canceled with ctx
+func (m *ModelService) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	start := time.Now()
+	value, err := m.predict(ctx, tickers)
+	observe(tickers, start, value, err)
+	return value, err
+}
+
+// observe updates the metrics of the prediction started at start
+func observe(tickers []domain.Ticker, start time.Time, value float64, err error) {
+	metrics.PredictDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.PredictErrors.Inc()
+		return
+	}
+	if len(tickers) > 0 {
+		instrument := strings.ToLower(tickers[len(tickers)-1].ProductId)
+		metrics.PredictedValue.WithLabelValues(instrument).Observe(value)
+	}
 }
 
-func (m *ModelService) Predict(tickers ...domain.Ticker) (float64, error) {
-	sequence := toSequence(tickers)
+func (m *ModelService) predict(ctx context.Context, tickers []domain.Ticker) (float64, error) {
+	rows := m.pipeline.Transform(tickers)
+	sequence := make([]vector, 0, len(rows))
+	for _, row := range rows {
+		sequence = append(sequence, row)
+	}
 	data := tfServeData{DefaultSignatureName,
 		[][]vector{sequence}}
 	postBody, _ := json.Marshal(data)
-	resp, err := http.Post(m.url, "application/json", bytes.NewBuffer(postBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewBuffer(postBody))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -49,24 +95,8 @@ func (m *ModelService) Predict(tickers ...domain.Ticker) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return tfResp.Predictions[0][0], nil
-}
-
-func toSequence(tickers []domain.Ticker) []vector {
-	sequence := make([]vector, 0, len(tickers))
-	for _, ticker := range tickers {
-		vec := vector{
-			ticker.Bid,
-			ticker.Ask,
-			ticker.BidSize,
-			ticker.AskSize,
-			ticker.Volume,
-			float64(ticker.Dtm),
-			ticker.Last,
-			ticker.Change,
-			ticker.OpenInterest,
-		}
-		sequence = append(sequence, vec)
+	if len(tfResp.Predictions) == 0 || len(tfResp.Predictions[0]) == 0 {
+		return 0, ErrNoPredictions
 	}
-	return sequence
+	return tfResp.Predictions[0][0], nil
 }
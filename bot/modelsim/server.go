@@ -0,0 +1,66 @@
+// Package modelsim is a fake TensorFlow Serving PredictionService for tests and local runs
+package modelsim
+
+import (
+	"context"
+	"net"
+	// not-std
+	"bot/tfserving"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultOutput is the name of the output tensor
+const DefaultOutput = "output_0"
+
+// Server answers Predict of the model with the value of the predict function
+type Server struct {
+	Model   string
+	Input   string // accepted input tensor
+	predict func(sequence [][]float32) float32
+	server  *grpc.Server
+}
+
+func New(model string, input string, predict func(sequence [][]float32) float32) *Server {
+	s := &Server{Model: model, Input: input, predict: predict}
+	s.server = tfserving.NewServer(s)
+	return s
+}
+
+// Listen serves on the address in background and returns the listening address,
+// e.g. for "127.0.0.1:0"
+func (s *Server) Listen(address string) (string, error) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", err
+	}
+	go s.server.Serve(lis)
+	return lis.Addr().String(), nil
+}
+
+func (s *Server) Stop() {
+	s.server.Stop()
+}
+
+func (s *Server) Predict(ctx context.Context, req *tfserving.PredictRequest) (*tfserving.PredictResponse, error) {
+	if req.ModelSpec.Name != s.Model {
+		return nil, status.Errorf(codes.NotFound, "servable %q not found", req.ModelSpec.Name)
+	}
+	input, ok := req.Inputs[s.Input]
+	if !ok || len(input.Shape) != 3 || input.Shape[0] != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "input %q of shape [1, sequence, features] is expected", s.Input)
+	}
+	length, width := int(input.Shape[1]), int(input.Shape[2])
+	if len(input.Values) != length*width {
+		return nil, status.Error(codes.InvalidArgument, "tensor size doesn't match the shape")
+	}
+	sequence := make([][]float32, 0, length)
+	for i := 0; i < length; i++ {
+		sequence = append(sequence, input.Values[i*width:(i+1)*width])
+	}
+	return &tfserving.PredictResponse{
+		ModelSpec: req.ModelSpec,
+		Outputs:   map[string]tfserving.Tensor{DefaultOutput: {Shape: []int64{1, 1}, Values: []float32{s.predict(sequence)}}},
+	}, nil
+}
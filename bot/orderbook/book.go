@@ -0,0 +1,186 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	// not-std
+	"bot/domain"
+)
+
+var (
+	ErrSequenceGap       = errors.New("sequence gap")
+	ErrNotSynced         = errors.New("book is not synced")
+	ErrInsufficientDepth = errors.New("insufficient depth")
+)
+
+// Book holds sorted price levels of one product, built from a book snapshot
+// and the following deltas. A delta out of sequence unsyncs the book until
+// the next snapshot.
+type Book struct {
+	ProductID string
+	bids      []domain.BookLevel // descending
+	asks      []domain.BookLevel // ascending
+	seq       int64
+	synced    bool
+}
+
+func NewBook(productID string) *Book {
+	return &Book{ProductID: productID}
+}
+
+// Snapshot replaces all levels
+func (b *Book) Snapshot(snapshot domain.BookSnapshot) {
+	b.bids = levels(snapshot.Bids, true)
+	b.asks = levels(snapshot.Asks, false)
+	b.seq = snapshot.Seq
+	b.synced = true
+}
+
+// Update applies a delta, the book is unsynced on a sequence gap
+func (b *Book) Update(update domain.BookUpdate) error {
+	if !b.synced {
+		return ErrNotSynced
+	}
+	if update.Seq <= b.seq {
+		return nil // already applied
+	}
+	if update.Seq != b.seq+1 {
+		b.synced = false
+		return fmt.Errorf("%w: %s expected %d, got %d", ErrSequenceGap, b.ProductID, b.seq+1, update.Seq)
+	}
+	b.seq = update.Seq
+	if update.Side == string(domain.Buy) {
+		b.bids = setLevel(b.bids, update.Price, update.Qty, true)
+	} else {
+		b.asks = setLevel(b.asks, update.Price, update.Qty, false)
+	}
+	return nil
+}
+
+func (b *Book) Synced() bool {
+	return b.synced
+}
+
+func (b *Book) Seq() int64 {
+	return b.seq
+}
+
+func (b *Book) BestBid() (domain.BookLevel, bool) {
+	if !b.synced || len(b.bids) == 0 {
+		return domain.BookLevel{}, false
+	}
+	return b.bids[0], true
+}
+
+func (b *Book) BestAsk() (domain.BookLevel, bool) {
+	if !b.synced || len(b.asks) == 0 {
+		return domain.BookLevel{}, false
+	}
+	return b.asks[0], true
+}
+
+func (b *Book) Mid() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return (bid.Price + ask.Price) / 2, true
+}
+
+func (b *Book) Spread() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return ask.Price - bid.Price, true
+}
+
+// Depth returns up to n best levels of each side
+func (b *Book) Depth(n int) (bids []domain.BookLevel, asks []domain.BookLevel) {
+	if !b.synced {
+		return nil, nil
+	}
+	return top(b.bids, n), top(b.asks, n)
+}
+
+// VWAP returns the volume-weighted price of a market order of the size:
+// a buy walks the asks, a sell walks the bids
+func (b *Book) VWAP(side domain.Action, size float64) (float64, error) {
+	if !b.synced {
+		return 0, ErrNotSynced
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid size %v", size)
+	}
+	book := b.asks
+	if side == domain.Sell {
+		book = b.bids
+	}
+	var filled, notional float64
+	for _, level := range book {
+		qty := level.Qty
+		if filled+qty > size {
+			qty = size - filled
+		}
+		filled += qty
+		notional += qty * level.Price
+		if filled >= size {
+			return notional / filled, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s %v of %v", ErrInsufficientDepth, side, filled, size)
+}
+
+// levels sorts a copy of the levels without empty ones
+func levels(src []domain.BookLevel, desc bool) []domain.BookLevel {
+	dst := make([]domain.BookLevel, 0, len(src))
+	for _, level := range src {
+		if level.Qty > 0 {
+			dst = append(dst, level)
+		}
+	}
+	sort.Slice(dst, func(i, j int) bool {
+		if desc {
+			return dst[i].Price > dst[j].Price
+		}
+		return dst[i].Price < dst[j].Price
+	})
+	return dst
+}
+
+// setLevel sets the quantity of the price, qty 0 removes the level
+func setLevel(book []domain.BookLevel, price float64, qty float64, desc bool) []domain.BookLevel {
+	i := sort.Search(len(book), func(i int) bool {
+		if desc {
+			return book[i].Price <= price
+		}
+		return book[i].Price >= price
+	})
+	found := i < len(book) && book[i].Price == price
+	switch {
+	case found && qty == 0:
+		return append(book[:i], book[i+1:]...)
+	case found:
+		book[i].Qty = qty
+		return book
+	case qty == 0:
+		return book
+	}
+	book = append(book, domain.BookLevel{})
+	copy(book[i+1:], book[i:])
+	book[i] = domain.BookLevel{Price: price, Qty: qty}
+	return book
+}
+
+func top(book []domain.BookLevel, n int) []domain.BookLevel {
+	if n > len(book) {
+		n = len(book)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return append([]domain.BookLevel(nil), book[:n]...)
+}
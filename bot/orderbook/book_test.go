@@ -0,0 +1,80 @@
+package orderbook
+
+import (
+	"bot/domain"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var snapshot = domain.BookSnapshot{
+	Feed:      domain.BookSnapshotFeed,
+	ProductId: "PI_XBTUSD",
+	Seq:       10,
+	Bids:      []domain.BookLevel{{Price: 99, Qty: 20}, {Price: 100, Qty: 10}, {Price: 98, Qty: 0}},
+	Asks:      []domain.BookLevel{{Price: 102, Qty: 5}, {Price: 101, Qty: 10}},
+}
+
+func update(seq int64, side domain.Action, price float64, qty float64) domain.BookUpdate {
+	return domain.BookUpdate{Feed: domain.BookFeed, ProductId: "PI_XBTUSD", Side: string(side), Seq: seq, Price: price, Qty: qty}
+}
+
+func TestBooks_Apply(t *testing.T) {
+	books := New()
+	_, ok := books.Mid("pi_xbtusd")
+	assert.False(t, ok)
+
+	assert.Nil(t, books.Apply(snapshot))
+	mid, _ := books.Mid("pi_xbtusd")
+	assert.Equal(t, 100.5, mid)
+	spread, _ := books.Spread("PI_XBTUSD")
+	assert.Equal(t, 1.0, spread)
+
+	assert.Nil(t, books.Apply(update(11, domain.Buy, 100.5, 3)))
+	assert.Nil(t, books.Apply(update(12, domain.Sell, 101, 0)))
+	bids, asks := books.Depth("PI_XBTUSD", 2)
+	assert.Equal(t, []domain.BookLevel{{Price: 100.5, Qty: 3}, {Price: 100, Qty: 10}}, bids)
+	assert.Equal(t, []domain.BookLevel{{Price: 102, Qty: 5}}, asks)
+
+	err := books.Apply(update(14, domain.Buy, 100, 1))
+	assert.True(t, errors.Is(err, ErrSequenceGap))
+	_, ok = books.BestBid("PI_XBTUSD")
+	assert.False(t, ok)
+
+	assert.Nil(t, books.Apply(snapshot))
+	bid, _ := books.BestBid("PI_XBTUSD")
+	assert.Equal(t, domain.BookLevel{Price: 100, Qty: 10}, bid)
+}
+
+func TestBook_VWAP(t *testing.T) {
+	book := NewBook("PI_XBTUSD")
+	book.Snapshot(snapshot)
+	price, err := book.VWAP(domain.Buy, 15)
+	assert.Nil(t, err)
+	assert.InDelta(t, (10*101+5*102)/15.0, price, 1e-9)
+	price, err = book.VWAP(domain.Sell, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, price)
+	_, err = book.VWAP(domain.Buy, 16)
+	assert.True(t, errors.Is(err, ErrInsufficientDepth))
+	_, err = book.VWAP(domain.Buy, 0)
+	assert.NotNil(t, err)
+	bids, asks := book.Depth(-1)
+	assert.Empty(t, bids)
+	assert.Empty(t, asks)
+}
+
+func TestBooks_SetProducts(t *testing.T) {
+	books := New()
+	assert.Nil(t, books.Apply(snapshot))
+	// the last products are picked up by Follow
+	books.SetProducts("PI_XBTUSD")
+	books.SetProducts("PI_ETHUSD")
+	products := <-books.products
+	assert.Equal(t, []string{"PI_ETHUSD"}, products)
+
+	books.retain(products)
+	_, ok := books.Mid("PI_XBTUSD")
+	assert.False(t, ok)
+	assert.Empty(t, books.books)
+}
@@ -0,0 +1,174 @@
+package orderbook
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	// not-std
+	"bot/domain"
+	"bot/krakenapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// Streamer opens feed subscriptions, implemented by krakenapi.KrakenAPI
+type Streamer interface {
+	OpenStream(subs ...krakenapi.Subscription) (*krakenapi.Stream, error)
+}
+
+// Books keeps order books of several products, safe for concurrent use.
+// Products are matched case-insensitively.
+type Books struct {
+	mu       sync.RWMutex
+	books    map[string]*Book
+	products chan []string // new products of Follow
+}
+
+func New() *Books {
+	return &Books{books: make(map[string]*Book), products: make(chan []string, 1)}
+}
+
+// SetProducts makes Follow resubscribe to the books of the products,
+// books of the other products are dropped
+func (b *Books) SetProducts(productIDs ...string) {
+	// a copy, not nil even without products
+	productIDs = append([]string{}, productIDs...)
+	for {
+		select {
+		case b.products <- productIDs:
+			return
+		default:
+			// replace the products not picked up yet
+			select {
+			case <-b.products:
+			default:
+			}
+		}
+	}
+}
+
+// Apply updates the books with a domain.BookSnapshot or domain.BookUpdate,
+// other messages are ignored
+func (b *Books) Apply(msg interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch m := msg.(type) {
+	case domain.BookSnapshot:
+		b.book(m.ProductId).Snapshot(m)
+	case domain.BookUpdate:
+		return b.book(m.ProductId).Update(m)
+	}
+	return nil
+}
+
+func (b *Books) book(productID string) *Book {
+	key := strings.ToLower(productID)
+	book, ok := b.books[key]
+	if !ok {
+		book = NewBook(productID)
+		b.books[key] = book
+	}
+	return book
+}
+
+// Follow keeps the books of the products in sync with the book feed until ctx
+// is done. The feed is resubscribed on a sequence gap to get a new snapshot.
+// The products are changed by SetProducts.
+func (b *Books) Follow(ctx context.Context, api Streamer, productIDs ...string) error {
+	for {
+		stream, err := api.OpenStream(krakenapi.Subscription{Feed: domain.BookFeed, ProductIDs: productIDs})
+		if err != nil {
+			return err
+		}
+		products, resync, err := b.follow(ctx, stream)
+		stream.Close()
+		switch {
+		case products != nil:
+			log.Info("order book: products changed, resubscribing")
+			productIDs = products
+			b.retain(productIDs)
+		case !resync:
+			return err
+		default:
+			log.Warning("order book: ", err, ", resync")
+		}
+	}
+}
+
+// follow applies the stream messages until a sequence gap, new products or ctx is done
+func (b *Books) follow(ctx context.Context, stream *krakenapi.Stream) (products []string, resync bool, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false, nil
+		case products := <-b.products:
+			return products, false, nil
+		case msg, ok := <-stream.Messages():
+			if !ok {
+				return nil, false, krakenapi.ErrStreamClosed
+			}
+			if err := b.Apply(msg); errors.Is(err, ErrSequenceGap) {
+				return nil, true, err
+			}
+		}
+	}
+}
+
+// retain drops the books of the products not in the list
+func (b *Books) retain(productIDs []string) {
+	keep := make(map[string]bool, len(productIDs))
+	for _, id := range productIDs {
+		keep[strings.ToLower(id)] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.books {
+		if !keep[key] {
+			delete(b.books, key)
+		}
+	}
+}
+
+func (b *Books) BestBid(productID string) (domain.BookLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).BestBid()
+}
+
+func (b *Books) BestAsk(productID string) (domain.BookLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).BestAsk()
+}
+
+func (b *Books) Mid(productID string) (float64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).Mid()
+}
+
+func (b *Books) Spread(productID string) (float64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).Spread()
+}
+
+func (b *Books) Depth(productID string, n int) (bids []domain.BookLevel, asks []domain.BookLevel) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).Depth(n)
+}
+
+func (b *Books) VWAP(productID string, side domain.Action, size float64) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.get(productID).VWAP(side, size)
+}
+
+// get returns the book or an empty unsynced one
+func (b *Books) get(productID string) *Book {
+	if book, ok := b.books[strings.ToLower(productID)]; ok {
+		return book
+	}
+	return NewBook(productID)
+}
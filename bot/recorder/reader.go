@@ -0,0 +1,173 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// ReadPath reads a recorded file or all recorded files of a directory in name order
+func ReadPath(path string) ([]domain.Ticker, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return ReadFile(path)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	var tickers []domain.Ticker
+	for _, name := range names {
+		t, err := ReadFile(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, t...)
+	}
+	return tickers, nil
+}
+
+// ReadFile reads a .jsonl or .csv file, optionally gzip compressed (.gz)
+func ReadFile(path string) ([]domain.Ticker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	name := path
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	var tickers []domain.Ticker
+	if strings.HasSuffix(name, "."+CSV) {
+		tickers, err = ReadCSV(r)
+	} else {
+		tickers, err = ReadJSONL(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tickers, nil
+}
+
+// ReadJSONL reads tickers recorded as JSON lines in the Kraken feed format.
+// Lines that are not ticker messages (info, subscribed, etc.) are skipped.
+func ReadJSONL(r io.Reader) ([]domain.Ticker, error) {
+	var tickers []domain.Ticker
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		ticker := domain.Ticker{}
+		if err := json.Unmarshal(scanner.Bytes(), &ticker); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ticker.ProductId == "" {
+			continue
+		}
+		tickers = append(tickers, ticker)
+	}
+	return tickers, scanner.Err()
+}
+
+// ReadCSV reads tickers written in the CSV format
+func ReadCSV(r io.Reader) ([]domain.Ticker, error) {
+	var tickers []domain.Ticker
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || line == 1 && text+"\n" == csvHeader {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 11 {
+			return nil, fmt.Errorf("line %d: expected 11 fields, got %d", line, len(fields))
+		}
+		var values [11]float64
+		for i, field := range fields {
+			if i == 1 {
+				continue
+			}
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			values[i] = v
+		}
+		tickers = append(tickers, domain.Ticker{
+			Time:         int64(values[0]),
+			Feed:         "ticker",
+			ProductId:    fields[1],
+			Bid:          values[2],
+			Ask:          values[3],
+			BidSize:      values[4],
+			AskSize:      values[5],
+			Volume:       values[6],
+			Dtm:          int(values[7]),
+			Last:         values[8],
+			Change:       values[9],
+			OpenInterest: values[10],
+		})
+	}
+	return tickers, scanner.Err()
+}
+
+// Play sends the tickers keeping the original intervals between them divided
+// by speed (2 plays twice as fast), speed <= 0 sends without delays.
+// The channel is closed at the end or when the context is canceled.
+func Play(ctx context.Context, tickers []domain.Ticker, speed float64) <-chan domain.Ticker {
+	out := make(chan domain.Ticker)
+	go func() {
+		defer close(out)
+		start := time.Now()
+		for _, ticker := range tickers {
+			if speed > 0 && len(tickers) > 0 {
+				offset := time.Duration(ticker.Time-tickers[0].Time) * time.Millisecond
+				delay := time.Until(start.Add(time.Duration(float64(offset) / speed)))
+				if delay > 0 {
+					select {
+					case <-time.After(delay):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case out <- ticker:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,163 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// File formats
+const (
+	JSONL = "jsonl" // Kraken ticker messages
+	CSV   = "csv"   // time, product id and the fields of Ticker.String()
+)
+
+const (
+	DefaultRotateInterval = time.Hour
+	DefaultRotateSize     = 100 << 20
+	flushInterval         = time.Second
+)
+
+const csvHeader = "time,product_id,bid,ask,bid_size,ask_size,volume,dtm,last,change,open_interest\n"
+
+type Config struct {
+	Dir            string        `yaml:"dir"`
+	Format         string        `yaml:"format"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	RotateSize     int64         `yaml:"rotate_size"` // uncompressed bytes
+}
+
+// Recorder writes tickers to gzip compressed files, a new file is started
+// after RotateInterval or RotateSize bytes. Files are named by their start
+// time, so sorting by name gives the chronological order.
+type Recorder struct {
+	mu      sync.Mutex
+	config  Config
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	opened  time.Time
+	flushed time.Time
+	written int64
+}
+
+func New(config Config) (*Recorder, error) {
+	if config.Format == "" {
+		config.Format = JSONL
+	}
+	if config.Format != JSONL && config.Format != CSV {
+		return nil, fmt.Errorf("unknown format %q", config.Format)
+	}
+	if config.RotateInterval <= 0 {
+		config.RotateInterval = DefaultRotateInterval
+	}
+	if config.RotateSize <= 0 {
+		config.RotateSize = DefaultRotateSize
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Recorder{config: config}, nil
+}
+
+func (r *Recorder) Write(ticker domain.Ticker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.file == nil || now.Sub(r.opened) >= r.config.RotateInterval || r.written >= r.config.RotateSize {
+		if err := r.rotate(now); err != nil {
+			return err
+		}
+	}
+	var line []byte
+	if r.config.Format == CSV {
+		line = []byte(fmt.Sprintf("%d,%s,%s\n", ticker.Time, ticker.ProductId, ticker.String()))
+	} else {
+		data, err := json.Marshal(ticker)
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	}
+	n, err := r.buf.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		return err
+	}
+	if now.Sub(r.flushed) >= flushInterval {
+		r.flushed = now
+		return r.flush()
+	}
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *Recorder) rotate(now time.Time) error {
+	if err := r.close(); err != nil {
+		return err
+	}
+	file, err := r.create(now)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.buf = bufio.NewWriter(r.gz)
+	r.opened, r.flushed, r.written = now, now, 0
+	if r.config.Format == CSV {
+		_, err = io.WriteString(r.buf, csvHeader)
+	}
+	return err
+}
+
+// create opens a new file named by the time, rotations within the same
+// millisecond get a sequence suffix which sorts after the plain name
+func (r *Recorder) create(now time.Time) (*os.File, error) {
+	stamp := now.UTC().Format("20060102T150405.000")
+	name := fmt.Sprintf("tickers-%s.%s.gz", stamp, r.config.Format)
+	for seq := 1; ; seq++ {
+		file, err := os.OpenFile(filepath.Join(r.config.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+		name = fmt.Sprintf("tickers-%s_%03d.%s.gz", stamp, seq, r.config.Format)
+	}
+}
+
+func (r *Recorder) flush() error {
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+func (r *Recorder) close() error {
+	if r.file == nil {
+		return nil
+	}
+	defer func() { r.file = nil }()
+	if err := r.buf.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
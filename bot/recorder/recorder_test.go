@@ -0,0 +1,84 @@
+package recorder
+
+import (
+	"bot/domain"
+	"bot/service"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var tickers = []domain.Ticker{
+	{Time: 1612270825253, Feed: "ticker", ProductId: "PI_XBTUSD", Bid: 34832.5, Ask: 34847.5, BidSize: 42864, AskSize: 2300, Last: 34852},
+	{Time: 1612270825353, Feed: "ticker", ProductId: "PI_ETHUSD", Bid: 1532.5, Ask: 1533, BidSize: 100, AskSize: 200, Last: 1533},
+}
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	for _, format := range []string{JSONL, CSV} {
+		dir := t.TempDir()
+		rec, err := New(Config{Dir: dir, Format: format, RotateSize: 1})
+		assert.Nil(t, err)
+		// rotations within a millisecond don't overwrite the files
+		for _, ticker := range tickers {
+			assert.Nil(t, rec.Write(ticker))
+		}
+		assert.Nil(t, rec.Close())
+		read, err := ReadPath(dir)
+		assert.Nil(t, err)
+		assert.Equal(t, tickers, read, format)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	start := time.Now()
+	var played []domain.Ticker
+	for ticker := range Play(context.Background(), tickers, 2) {
+		played = append(played, ticker)
+	}
+	assert.Equal(t, tickers, played)
+	// 100ms between tickers at double speed
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+type feedExchange struct {
+	service.ExchangeAPI
+	feed chan domain.Ticker
+}
+
+func (e feedExchange) Subscribe(instruments ...string) (<-chan domain.Ticker, error) {
+	return e.feed, nil
+}
+
+func (e feedExchange) Unsubscribe() error { return nil }
+
+func TestTee_Unsubscribe(t *testing.T) {
+	rec, err := New(Config{Dir: t.TempDir()})
+	assert.Nil(t, err)
+	defer rec.Close()
+	exchange := Tee(feedExchange{feed: make(chan domain.Ticker, 1)}, rec)
+	out, err := exchange.Subscribe("PI_XBTUSD")
+	assert.Nil(t, err)
+	feed := exchange.(*teeExchange).ExchangeAPI.(feedExchange).feed
+	feed <- tickers[0]
+	for len(feed) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// nobody reads the ticker, the forwarding stops on Unsubscribe
+	assert.Nil(t, exchange.Unsubscribe())
+	select {
+	case <-drained(out):
+	case <-time.After(time.Second):
+		t.Fatal("forwarding goroutine is blocked")
+	}
+}
+
+func drained(tickers <-chan domain.Ticker) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range tickers {
+		}
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,70 @@
+package recorder
+
+import (
+	"sync"
+	// not-std
+	"bot/domain"
+	"bot/service"
+	log "github.com/sirupsen/logrus"
+)
+
+type teeExchange struct {
+	service.ExchangeAPI
+	recorder *Recorder
+	mu       sync.Mutex
+	done     chan struct{} // closed when the subscription is replaced or closed
+}
+
+// Tee returns the exchange which records every ticker received by Subscribe
+func Tee(exchange service.ExchangeAPI, recorder *Recorder) service.ExchangeAPI {
+	return &teeExchange{ExchangeAPI: exchange, recorder: recorder}
+}
+
+func (t *teeExchange) Subscribe(instruments ...string) (<-chan domain.Ticker, error) {
+	in, err := t.ExchangeAPI.Subscribe(instruments...)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	t.mu.Lock()
+	if t.done != nil {
+		close(t.done)
+	}
+	t.done = done
+	t.mu.Unlock()
+	out := make(chan domain.Ticker)
+	go func() {
+		defer close(out)
+		for {
+			var ticker domain.Ticker
+			var ok bool
+			select {
+			case ticker, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+			if err := t.recorder.Write(ticker); err != nil {
+				log.Error("recorder: ", err)
+			}
+			select {
+			case out <- ticker:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (t *teeExchange) Unsubscribe() error {
+	t.mu.Lock()
+	if t.done != nil {
+		close(t.done)
+		t.done = nil
+	}
+	t.mu.Unlock()
+	return t.ExchangeAPI.Unsubscribe()
+}
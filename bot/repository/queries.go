@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// not-std
+	"bot/domain"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+const selectEventsQuery = `SELECT coalesce(decision_id, ''),
+							coalesce(order_id, ''),
+							coalesce(status, ''),
+							coalesce(event_type, ''),
+							coalesce(execution_id, ''),
+							coalesce(reason, ''),
+							coalesce(symbol, ''),
+							coalesce(side, ''),
+							coalesce(type, ''),
+							coalesce(order_price, 0),
+							coalesce(order_size, 0),
+							coalesce(actual_price, 0),
+							coalesce(actual_amount, 0),
+							timestamp,
+							coalesce(trigger, '')
+						FROM orders`
+
+// Orders returns stored order events matching the filter, newest first
+func (repo *OrderEventsStorage) Orders(ctx context.Context, filter domain.OrderFilter) ([]domain.EventRecord, error) {
+	where, args := repo.filterConditions(filter, "side")
+	query := selectEventsQuery + where + pageClause(filter, &args)
+	return repo.selectEvents(ctx, query, args...)
+}
+
+// filterConditions returns the where clause with its arguments, the side is matched in the side column
+func (repo *OrderEventsStorage) filterConditions(filter domain.OrderFilter, side string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	addCondition("paper = $%d", repo.paper)
+	if filter.Symbol != "" {
+		addCondition("lower(symbol) = lower($%d)", filter.Symbol)
+	}
+	if filter.Side != "" {
+		addCondition(side+" = $%d", filter.Side)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp < $%d", filter.To)
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// pageClause returns ordering and pagination, newest first
+func pageClause(filter domain.OrderFilter, args *[]interface{}) string {
+	limit := filter.Limit
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+	*args = append(*args, limit, filter.Offset)
+	return fmt.Sprintf(" ORDER BY timestamp DESC, id DESC LIMIT $%d OFFSET $%d", len(*args)-1, len(*args))
+}
+
+const selectVetoesQuery = `SELECT coalesce(decision_id, ''),
+							risk_check,
+							reason,
+							symbol,
+							side,
+							type,
+							order_price,
+							order_size,
+							allowed_size,
+							timestamp
+						FROM risk_vetoes`
+
+// Vetoes returns stored risk vetoes matching the filter, newest first
+func (repo *OrderEventsStorage) Vetoes(ctx context.Context, filter domain.OrderFilter) ([]domain.RiskVeto, error) {
+	where, args := repo.filterConditions(filter, "side")
+	query := selectVetoesQuery + where + pageClause(filter, &args)
+	rows, err := repo.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vetoes := make([]domain.RiskVeto, 0)
+	for rows.Next() {
+		var veto domain.RiskVeto
+		err := rows.Scan(
+			&veto.DecisionID,
+			&veto.Check,
+			&veto.Reason,
+			&veto.Order.Symbol,
+			&veto.Order.Side,
+			&veto.Order.Type,
+			&veto.Order.LimitPrice,
+			&veto.Order.Quantity,
+			&veto.AllowedSize,
+			&veto.TS)
+		if err != nil {
+			return nil, err
+		}
+		veto.Order.TS = veto.TS
+		vetoes = append(vetoes, veto)
+	}
+	return vetoes, rows.Err()
+}
+
+// Positions returns net positions calculated from stored executions
+func (repo *OrderEventsStorage) Positions(ctx context.Context) ([]domain.Position, error) {
+	executions, err := repo.executions(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]*domain.CostBasis)
+	var symbols []string
+	for _, e := range executions {
+		symbol := strings.ToLower(e.ExecOrder.Symbol)
+		pos, ok := positions[symbol]
+		if !ok {
+			pos = &domain.CostBasis{}
+			positions[symbol] = pos
+			symbols = append(symbols, symbol)
+		}
+		pos.Apply(signedAmount(e), e.Price)
+	}
+	result := make([]domain.Position, 0, len(positions))
+	for _, symbol := range symbols {
+		if pos := positions[symbol]; pos.Size != 0 {
+			result = append(result, pos.Position(symbol))
+		}
+	}
+	return result, nil
+}
+
+// DailyPnL returns realized P&L per instrument per day (UTC) in [from, to).
+// Executions before from are replayed to get the entry prices.
+func (repo *OrderEventsStorage) DailyPnL(ctx context.Context, from time.Time, to time.Time) ([]domain.DailyPnL, error) {
+	executions, err := repo.executions(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]*domain.CostBasis)
+	result := make([]domain.DailyPnL, 0)
+	index := make(map[string]int) // day+symbol -> index in result
+	for _, e := range executions {
+		symbol := strings.ToLower(e.ExecOrder.Symbol)
+		pos, ok := positions[symbol]
+		if !ok {
+			pos = &domain.CostBasis{}
+			positions[symbol] = pos
+		}
+		realized := pos.Apply(signedAmount(e), e.Price)
+		if e.ExecOrder.TS.Before(from) {
+			continue
+		}
+		day := e.ExecOrder.TS.UTC().Format("2006-01-02")
+		i, ok := index[day+symbol]
+		if !ok {
+			i = len(result)
+			index[day+symbol] = i
+			result = append(result, domain.DailyPnL{Day: day, Symbol: symbol})
+		}
+		result[i].RealizedPnL += realized
+		result[i].Volume += e.Amount
+		result[i].Trades++
+	}
+	return result, nil
+}
+
+// executions returns all stored executions before the moment in chronological order
+func (repo *OrderEventsStorage) executions(ctx context.Context, before time.Time) ([]domain.EventRecord, error) {
+	query := selectEventsQuery + " WHERE event_type = $1 AND timestamp < $2 AND paper = $3 ORDER BY timestamp, id"
+	return repo.selectEvents(ctx, query, domain.ExecutionEvent, before, repo.paper)
+}
+
+func (repo *OrderEventsStorage) selectEvents(ctx context.Context, query string, args ...interface{}) ([]domain.EventRecord, error) {
+	rows, err := repo.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]domain.EventRecord, 0)
+	for rows.Next() {
+		var record domain.EventRecord
+		var order domain.Order
+		var ts *time.Time
+		err := rows.Scan(
+			&record.DecisionID,
+			&record.OrderID,
+			&record.Status,
+			&record.Type,
+			&record.ExecutionID,
+			&record.Reason,
+			&order.Symbol,
+			&order.Side,
+			&order.Type,
+			&order.LimitPrice,
+			&order.Quantity,
+			&record.Price,
+			&record.Amount,
+			&ts,
+			&record.Trigger)
+		if err != nil {
+			return nil, err
+		}
+		if ts != nil {
+			order.TS = *ts
+		}
+		order.OrderID = record.OrderID
+		if record.Type == domain.ExecutionEvent {
+			record.ExecOrder = &order
+		} else {
+			record.Order = &order
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func signedAmount(e domain.EventRecord) int64 {
+	if e.ExecOrder.Side == domain.Sell {
+		return -e.Amount
+	}
+	return e.Amount
+}
+
+const selectPredictionsQuery = `SELECT decision_id,
+							coalesce(symbol, ''),
+							coalesce(strategy, ''),
+							coalesce(model, ''),
+							coalesce(value, 0),
+							coalesce(threshold, 0),
+							coalesce(action, ''),
+							coalesce(size, 0),
+							coalesce(price, 0),
+							coalesce(error, ''),
+							coalesce(sequence_hash, ''),
+							coalesce(sequence_from, 0),
+							coalesce(sequence_to, 0),
+							timestamp,
+							coalesce((SELECT o.order_id FROM orders o
+								WHERE o.decision_id = predictions.decision_id AND o.order_id <> ''
+								ORDER BY o.id LIMIT 1), '')`
+
+// Predictions returns the audit records of the decisions matching the filter
+// without the tickers, newest first. The side of the filter is the action.
+func (repo *OrderEventsStorage) Predictions(ctx context.Context, filter domain.OrderFilter) ([]domain.PredictionRecord, error) {
+	where, args := repo.filterConditions(filter, "action")
+	query := selectPredictionsQuery + " FROM predictions" + where + pageClause(filter, &args)
+	rows, err := repo.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]domain.PredictionRecord, 0)
+	for rows.Next() {
+		var record domain.PredictionRecord
+		if err := rows.Scan(predictionFields(&record)...); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Prediction returns the audit record of the decision with the tickers, nil if it's not found
+func (repo *OrderEventsStorage) Prediction(ctx context.Context, decisionID string) (*domain.PredictionRecord, error) {
+	query := selectPredictionsQuery + ", coalesce(tickers, '[]') FROM predictions WHERE decision_id = $1 AND paper = $2"
+	var record domain.PredictionRecord
+	var tickers []byte
+	err := repo.pool.QueryRow(ctx, query, decisionID, repo.paper).Scan(append(predictionFields(&record), &tickers)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tickers, &record.Tickers); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// predictionFields returns the destinations of selectPredictionsQuery columns
+func predictionFields(record *domain.PredictionRecord) []interface{} {
+	return []interface{}{
+		&record.DecisionID,
+		&record.Symbol,
+		&record.Strategy,
+		&record.Model,
+		&record.Value,
+		&record.Threshold,
+		&record.Action,
+		&record.Size,
+		&record.Price,
+		&record.Error,
+		&record.SequenceHash,
+		&record.SequenceFrom,
+		&record.SequenceTo,
+		&record.TS,
+		&record.OrderID,
+	}
+}
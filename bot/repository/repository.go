@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
 	// not-std
 	"bot/domain"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 func NewPool(dsn string) (*pgxpool.Pool, error) {
@@ -20,17 +22,30 @@ func NewPool(dsn string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
+// OrderEventsStorage stores and queries either live or paper trading records
 type OrderEventsStorage struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	paper bool
 }
 
 func New(pool *pgxpool.Pool) *OrderEventsStorage {
-	return &OrderEventsStorage{pool}
+	return &OrderEventsStorage{pool, false}
+}
+
+// NewPaper returns storage of paper trading records
+func NewPaper(pool *pgxpool.Pool) *OrderEventsStorage {
+	return &OrderEventsStorage{pool, true}
 }
 
 var InsertError = errors.New("failed to insert event to repo")
 
 const insertEventQuery = `INSERT INTO orders (
+							decision_id,
+							order_id,
+							status,
+							event_type,
+							execution_id,
+							reason,
 							symbol, 
                           	side, 
 							type, 
@@ -38,19 +53,119 @@ const insertEventQuery = `INSERT INTO orders (
 							order_size,
 							actual_price, 
 							actual_amount,
-							timestamp
-						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+							timestamp,
+							paper,
+							trigger
+						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`
 
-func (repo *OrderEventsStorage) StoreEvent(ctx context.Context, event domain.OrderEvent) error {
+func (repo *OrderEventsStorage) StoreEvent(ctx context.Context, record domain.EventRecord) error {
+	order := record.OrderInfo()
+	if order == nil {
+		order = &domain.Order{TS: time.Now()}
+	}
 	commandTag, err := repo.pool.Exec(ctx, insertEventQuery,
-		event.ExecOrder.Symbol,
-		event.ExecOrder.Side,
-		event.ExecOrder.Type,
-		event.ExecOrder.LimitPrice,
-		event.ExecOrder.Quantity,
-		event.Price,
-		event.Amount,
-		event.ExecOrder.TS)
+		record.DecisionID,
+		record.OrderID,
+		record.Status,
+		record.Type,
+		record.ExecutionID,
+		record.Reason,
+		order.Symbol,
+		order.Side,
+		order.Type,
+		order.LimitPrice,
+		order.Quantity,
+		record.Price,
+		record.Amount,
+		order.TS,
+		repo.paper,
+		record.Trigger)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return InsertError
+	}
+	return nil
+}
+
+const insertVetoQuery = `INSERT INTO risk_vetoes (
+							decision_id,
+							risk_check,
+							reason,
+							symbol,
+							side,
+							type,
+							order_price,
+							order_size,
+							allowed_size,
+							timestamp,
+							paper
+						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+func (repo *OrderEventsStorage) StoreVeto(ctx context.Context, veto domain.RiskVeto) error {
+	commandTag, err := repo.pool.Exec(ctx, insertVetoQuery,
+		veto.DecisionID,
+		veto.Check,
+		veto.Reason,
+		veto.Order.Symbol,
+		veto.Order.Side,
+		veto.Order.Type,
+		veto.Order.LimitPrice,
+		veto.Order.Quantity,
+		veto.AllowedSize,
+		veto.TS,
+		repo.paper)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return InsertError
+	}
+	return nil
+}
+
+const insertPredictionQuery = `INSERT INTO predictions (
+							decision_id,
+							symbol,
+							strategy,
+							model,
+							value,
+							threshold,
+							action,
+							size,
+							price,
+							error,
+							sequence_hash,
+							sequence_from,
+							sequence_to,
+							tickers,
+							timestamp,
+							paper
+						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`
+
+func (repo *OrderEventsStorage) StorePrediction(ctx context.Context, record domain.PredictionRecord) error {
+	tickers, err := json.Marshal(record.Tickers)
+	if err != nil {
+		return err
+	}
+	commandTag, err := repo.pool.Exec(ctx, insertPredictionQuery,
+		record.DecisionID,
+		record.Symbol,
+		record.Strategy,
+		record.Model,
+		record.Value,
+		record.Threshold,
+		record.Action,
+		record.Size,
+		record.Price,
+		record.Error,
+		record.SequenceHash,
+		record.SequenceFrom,
+		record.SequenceTo,
+		string(tickers),
+		record.TS,
+		repo.paper)
 	if err != nil {
 		return err
 	}
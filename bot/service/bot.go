@@ -6,24 +6,51 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 	// not-std
 	"bot/domain"
+	"bot/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
+var ErrFeedClosed = errors.New("ticker feed closed")
+
+// ExchangeAPI calls are canceled when the bot is stopped and are limited by Timeouts.Exchange
 type ExchangeAPI interface {
-	GetPositions() (*domain.OpenPositionsResponse, error)
-	SendOrder(order domain.Order) (*domain.SendOrderResponse, error)
+	GetPositions(ctx context.Context) (*domain.OpenPositionsResponse, error)
+	SendOrder(ctx context.Context, order domain.Order) (*domain.SendOrderResponse, error)
+	CancelOrder(ctx context.Context, orderID string) (*domain.CancelOrdersResponse, error)
 	Subscribe(instruments ...string) (<-chan domain.Ticker, error)
 	Unsubscribe() error
 }
 
+// Predictor calls are canceled when the bot is stopped and are limited by Timeouts.Predict
 type Predictor interface {
-	Predict(tickers ...domain.Ticker) (float64, error)
+	Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error)
+}
+
+// SourcePredictor is a Predictor that reports which model produced the value,
+// e.g. modelapi.Composite
+type SourcePredictor interface {
+	PredictWithSource(ctx context.Context, tickers ...domain.Ticker) (float64, string, error)
 }
 
 type Storage interface {
-	StoreEvent(ctx context.Context, event domain.OrderEvent) error
+	StoreEvent(ctx context.Context, record domain.EventRecord) error
+	StoreVeto(ctx context.Context, veto domain.RiskVeto) error
+	StorePrediction(ctx context.Context, record domain.PredictionRecord) error
+}
+
+// OrderBook gives the volume-weighted price of a market order from the local book
+type OrderBook interface {
+	VWAP(productID string, side domain.Action, size float64) (float64, error)
+}
+
+// FollowingOrderBook is an OrderBook kept for the given products,
+// e.g. orderbook.Books, they are changed with the instruments
+type FollowingOrderBook interface {
+	OrderBook
+	SetProducts(productIDs ...string)
 }
 
 type Notifier interface {
@@ -32,28 +59,42 @@ type Notifier interface {
 	Stop()
 }
 
-type Parameters struct {
-	Instrument        string  `yaml:"instrument"`
-	MaxPositionSize   int64   `yaml:"max_position_size"`
-	OrderSize         int64   `yaml:"order_size"`
-	DecisionThreshold float64 `yaml:"decision_threshold"`
-	SequenceLength    int     `yaml:"sequence_length"`
-	PriceSlipPercent  int64   `yaml:"price_slip_percent"`
-}
-
 type Bot struct {
 	// api
 	exchangeAPI ExchangeAPI
 	notifier    Notifier
 	storage     Storage
-	model       Predictor
+	model       Predictor // default model
+	models      map[string]Predictor
+	newModel    func(url string) Predictor
+	strategies  map[string]Strategy // custom strategies instead of the configured ones
+	book        OrderBook
 	// parameters
-	Parameters
+	params      Parameters
+	instruments map[string]InstrumentParameters
+	risk        *RiskManager
+	// state
+	muState     sync.Mutex
+	state       State
+	startedAt   time.Time
+	lastTicker  time.Time
+	predictions map[string]float64
+	sources     map[string]string // model of the last prediction
+	lastError   error
+	connection  string
+	quotes      map[string]domain.Ticker // last ticker per instrument
 	// internal variables
 	muParameters    sync.Mutex
 	muPositions     sync.Mutex
 	openPositions   map[string]int64
+	resting         map[string]*restingOrder // by order id
+	unmatchedFills  map[string][]domain.Fill // fills received before the order response
+	stops           map[string]*positionStop // entries of open positions
 	shutdownChannel chan interface{}
+	shutdownOnce    *sync.Once
+	cancel          context.CancelFunc // cancels calls in flight
+	done            chan struct{}      // closed when the processing has finished
+	reloadChannel   chan struct{}
 }
 
 func New(exchangeAPI ExchangeAPI,
@@ -62,91 +103,450 @@ func New(exchangeAPI ExchangeAPI,
 	model Predictor,
 	params Parameters) *Bot {
 	return &Bot{
-		exchangeAPI,
-		notifier,
-		storage,
-		model,
-		params,
-		sync.Mutex{},
-		sync.Mutex{},
-		make(map[string]int64),
-		make(chan interface{}),
+		exchangeAPI:    exchangeAPI,
+		notifier:       notifier,
+		storage:        storage,
+		model:          model,
+		models:         make(map[string]Predictor),
+		strategies:     make(map[string]Strategy),
+		params:         params,
+		instruments:    params.instrumentMap(),
+		risk:           NewRiskManager(params.Risk),
+		state:          StateStopped,
+		predictions:    make(map[string]float64),
+		sources:        make(map[string]string),
+		quotes:         make(map[string]domain.Ticker),
+		openPositions:  make(map[string]int64),
+		resting:        make(map[string]*restingOrder),
+		unmatchedFills: make(map[string][]domain.Fill),
+		stops:          make(map[string]*positionStop),
+		reloadChannel:  make(chan struct{}, 1),
 	}
 }
 
+// SetModel sets a model for the instrument instead of the default one
+func (b *Bot) SetModel(instrument string, model Predictor) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	b.models[symbolKey(instrument)] = model
+}
+
+// SetStrategy sets a custom strategy for the instrument instead of the configured one
+func (b *Bot) SetStrategy(instrument string, strategy Strategy) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	b.strategies[symbolKey(instrument)] = strategy
+}
+
+// SetModelFactory sets a constructor of models by url,
+// used when model_url of an instrument is changed by ChangeParameters
+func (b *Bot) SetModelFactory(newModel func(url string) Predictor) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	b.newModel = newModel
+}
+
+// SetOrderBook makes the limit price be based on the book depth instead of the ticker
+func (b *Bot) SetOrderBook(book OrderBook) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	b.book = book
+}
+
+// AddRiskCheck adds a custom check to the risk manager
+func (b *Bot) AddRiskCheck(check RiskCheck) {
+	b.risk.AddCheck(check)
+}
+
+// SetKillSwitch turns on or off the kill switch: no orders are sent while it's on
+func (b *Bot) SetKillSwitch(on bool) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	b.params.Risk.KillSwitch = on
+	b.risk.SetLimits(b.params.Risk)
+	log.Info("kill switch: ", on)
+}
+
+// Parameters returns current parameters
+func (b *Bot) Parameters() Parameters {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	return b.params
+}
+
+// ChangeParameters validates and applies new parameters. A running bot picks
+// them up between sequences and resubscribes, the order book too, only if the instruments changed.
+// The engaged kill switch is kept, it's turned off only by SetKillSwitch.
+func (b *Bot) ChangeParameters(params Parameters) (Parameters, error) {
+	if err := params.Validate(); err != nil {
+		return b.Parameters(), err
+	}
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	params.Risk.KillSwitch = params.Risk.KillSwitch || b.params.Risk.KillSwitch
+	instruments := params.instrumentMap()
+	models := make(map[string]Predictor)
+	for key, inst := range instruments {
+		old, ok := b.instruments[key]
+		switch {
+		case ok && old.ModelURL == inst.ModelURL:
+			if model, found := b.models[key]; found {
+				models[key] = model
+			}
+		case inst.ModelURL == "":
+			// default model
+		case b.newModel == nil:
+			return b.params, fmt.Errorf("%w: model of %s can't be changed", ErrInvalidParameters, inst.Instrument)
+		default:
+			models[key] = b.newModel(inst.ModelURL)
+		}
+	}
+	if book, ok := b.book.(FollowingOrderBook); ok && !equalIDs(b.params.InstrumentIDs(), params.InstrumentIDs()) {
+		book.SetProducts(params.InstrumentIDs()...)
+	}
+	b.params = params
+	b.instruments = instruments
+	b.models = models
+	b.risk.SetLimits(params.Risk)
+	// notify the running collector, skip if a reload is already pending
+	select {
+	case b.reloadChannel <- struct{}{}:
+	default:
+	}
+	log.Info("parameters changed: ", params.InstrumentList())
+	return b.params, nil
+}
+
+// Start subscribes to tickers and starts trading in background,
+// the bot must be stopped or failed
 func (b *Bot) Start() error {
+	if err := b.transition(StateStarting, StateStopped, StateFailed); err != nil {
+		return err
+	}
 	log.Info("start...")
-	if err := b.FetchOpenPositions(); err != nil {
+	if err := b.start(); err != nil {
+		b.setLastError(err)
+		_ = b.transition(StateFailed, StateStarting)
+		return err
+	}
+	return nil
+}
+
+func (b *Bot) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.FetchOpenPositions(ctx); err != nil {
+		cancel()
 		return fmt.Errorf("fetching positons failed: %w", err)
 	}
-	tickers, err := b.exchangeAPI.Subscribe(b.Instrument)
+	params := b.Parameters()
+	subscribed := params.InstrumentIDs()
+	tickers, err := b.exchangeAPI.Subscribe(subscribed...)
 	if err != nil {
+		cancel()
 		return err
 	}
 	if err := b.notifier.Start(); err != nil {
+		if err := b.exchangeAPI.Unsubscribe(); err != nil {
+			log.Error(err)
+		}
+		cancel()
 		return err
 	}
+	shutdown := make(chan interface{})
+	once := &sync.Once{}
+	done := make(chan struct{})
+	// running before the goroutines start, they may fail it at once
+	b.muState.Lock()
+	b.shutdownChannel, b.shutdownOnce = shutdown, once
+	b.cancel, b.done = cancel, done
+	b.state = StateRunning
+	b.startedAt = time.Now()
+	b.lastError = nil
+	b.muState.Unlock()
+	var wg sync.WaitGroup
+	wg.Add(3)
 	// collect tickers
-	tickerSequences := make(chan []domain.Ticker)
+	sequences := newSequenceQueue()
+	exits := make(chan domain.Decision, len(subscribed))
 	go func() {
+		defer wg.Done()
 		defer func() {
 			log.Info("shutdown")
-			close(tickerSequences)
+			// stops the other goroutines if the feed has failed
+			once.Do(func() { close(shutdown) })
 			b.notifier.Stop()
 			err := b.exchangeAPI.Unsubscribe()
 			if err != nil {
 				log.Error(err)
 			}
 		}()
-		seq := make([]domain.Ticker, 0, b.SequenceLength)
-		for ticker := range tickers {
+		seq := newSequenceRouter(params.InstrumentList())
+		for {
 			select {
-			case <-b.shutdownChannel:
+			case <-shutdown:
 				return
-			default:
-				if len(seq) == b.SequenceLength {
-					tickerSequences <- seq
-					seq = make([]domain.Ticker, 0, b.SequenceLength)
+			case <-b.reloadChannel:
+				params := b.Parameters()
+				seq = seq.reload(params.InstrumentList())
+				if equalIDs(subscribed, params.InstrumentIDs()) {
+					continue
+				}
+				log.Info("instruments changed, resubscribing")
+				if err := b.exchangeAPI.Unsubscribe(); err != nil {
+					log.Error(err)
+				}
+				go drain(tickers)
+				subscribed = params.InstrumentIDs()
+				if tickers, err = b.exchangeAPI.Subscribe(subscribed...); err != nil {
+					b.setLastError(err)
+					return
+				}
+			case ticker, ok := <-tickers:
+				if !ok {
+					b.setLastError(ErrFeedClosed)
+					return
+				}
+				b.setQuote(ticker)
+				metrics.TickersReceived.WithLabelValues(symbolKey(ticker.ProductId)).Inc()
+				b.risk.Observe(ticker)
+				if decision, ok := b.checkStops(ticker); ok {
+					select {
+					case exits <- decision:
+					default:
+						// triggered again after stopRetry
+					}
+				}
+				if tickers, ok := seq.push(ticker); ok {
+					sequences.put(tickers)
 				}
-				seq = append(seq, ticker)
 			}
 		}
 	}()
 	// process sequences
 	go func() {
-		for tickers := range tickerSequences {
-			err := b.processSequence(tickers)
-			if err != nil {
-				log.Error(err)
+		defer wg.Done()
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-sequences.ready:
+			}
+			for _, tickers := range sequences.take() {
+				err := b.processSequence(ctx, tickers)
+				if err != nil && ctx.Err() != nil {
+					// canceled by Stop
+					return
+				}
+				if err != nil {
+					log.Error(err)
+					b.setLastError(err)
+					once.Do(func() { close(shutdown) })
+					return
+				}
+			}
+		}
+	}()
+	// exit positions on stops, cancel and replace expired resting orders
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shutdown:
 				return
+			case decision := <-exits:
+				if err := b.executeStop(ctx, decision); err != nil && ctx.Err() == nil {
+					log.Error(err)
+				}
+			case <-ticker.C:
+				if err := b.replaceExpired(ctx); err != nil && ctx.Err() == nil {
+					log.Error("replace resting orders: ", err)
+				}
 			}
 		}
 	}()
-	return err
+	// stopped by Stop or by an error
+	go func() {
+		wg.Wait()
+		cancel()
+		b.muState.Lock()
+		defer b.muState.Unlock()
+		if b.state == StateStopping {
+			b.state = StateStopped
+		} else {
+			b.state = StateFailed
+		}
+		once.Do(func() { close(shutdown) })
+		close(done)
+		log.Info("bot ", b.state)
+	}()
+	return nil
 }
 
-func (b *Bot) processSequence(tickers []domain.Ticker) error {
-	action, err := b.makeDecision(tickers)
+// Replay synchronously feeds recorded tickers through the same collection and
+// processing path as Start. onTicker, if not nil, is called before each ticker
+// is consumed, so a simulated exchange can follow the tape.
+func (b *Bot) Replay(ctx context.Context, tickers []domain.Ticker, onTicker func(domain.Ticker)) error {
+	if err := b.FetchOpenPositions(ctx); err != nil {
+		return fmt.Errorf("fetching positons failed: %w", err)
+	}
+	seq := newSequenceRouter(b.Parameters().InstrumentList())
+	for _, ticker := range tickers {
+		if onTicker != nil {
+			onTicker(ticker)
+		}
+		b.setQuote(ticker)
+		b.risk.Observe(ticker)
+		if err := b.replaceExpired(ctx); err != nil {
+			return err
+		}
+		if decision, ok := b.checkStops(ticker); ok {
+			if err := b.executeStop(ctx, decision); err != nil {
+				return err
+			}
+		}
+		if tickers, ok := seq.push(ticker); ok {
+			if err := b.processSequence(ctx, tickers); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Bot) processSequence(ctx context.Context, tickers []domain.Ticker) error {
+	last := tickers[len(tickers)-1]
+	params, model, ok := b.instrument(last.ProductId)
+	if !ok {
+		return fmt.Errorf("unknown instrument %q", last.ProductId)
+	}
+	strategy, name := b.strategy(params, model)
+	signal, err := b.makeDecision(ctx, params, strategy, tickers)
+	record := domain.PredictionRecord{
+		DecisionID:   domain.NewID(),
+		Symbol:       params.Instrument,
+		Strategy:     name,
+		Model:        signal.Source,
+		Value:        signal.Value,
+		Threshold:    signal.Threshold,
+		Action:       signal.Action,
+		SequenceHash: domain.SequenceHash(tickers),
+		SequenceFrom: tickers[0].Time,
+		SequenceTo:   last.Time,
+		Tickers:      tickers,
+		TS:           time.Now(),
+	}
 	if err != nil {
+		b.storePrediction(ctx, record, err)
 		return fmt.Errorf("make decision failed: %w", err)
 	}
-	// calculate price
-	var price float64
-	if action == domain.Buy {
-		price = tickers[len(tickers)-1].Ask * (1 + float64(b.PriceSlipPercent)/100)
+	size := signal.Size
+	if size == 0 {
+		size = params.OrderSize
 	}
-	if action == domain.Sell {
-		price = tickers[len(tickers)-1].Bid * (1 - float64(b.PriceSlipPercent)/100)
-	}
-	err = b.ChangePosition(action, b.OrderSize, price)
+	price := b.limitPrice(params, signal.Action, size, last)
+	decision := domain.NewDecision(params.Instrument, signal.Action, size, price)
+	decision.ID = record.DecisionID
+	record.Size, record.Price = size, price
+	// stored after sending, the order is found by the decision id
+	err = b.ChangePosition(ctx, *decision)
+	b.storePrediction(ctx, record, err)
 	if err != nil {
 		return fmt.Errorf("position change failed: %w", err)
 	}
 	return nil
 }
 
-func (b *Bot) FetchOpenPositions() error {
-	resp, err := b.exchangeAPI.GetPositions()
+// storePrediction stores the audit record of the decision with its error,
+// calls canceled by stopping the bot are not decisions
+func (b *Bot) storePrediction(ctx context.Context, record domain.PredictionRecord, err error) {
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		record.Error = err.Error()
+	}
+	if err := b.storage.StorePrediction(context.Background(), record); err != nil {
+		metrics.StorageFailures.Inc()
+		log.Error(err)
+	}
+}
+
+// limitPrice is the price of the order book for the order size, or the ticker
+// price if the book is not available, plus the price slip
+func (b *Bot) limitPrice(params InstrumentParameters, action domain.Action, size int64, last domain.Ticker) float64 {
+	if action != domain.Buy && action != domain.Sell {
+		return 0
+	}
+	switch params.Execution {
+	case ExecutionPostOnly:
+		// join the best price of the own side
+		if action == domain.Buy {
+			return last.Bid
+		}
+		return last.Ask
+	case ExecutionMarket:
+		// reference price for the risk checks
+		if action == domain.Buy {
+			return last.Ask
+		}
+		return last.Bid
+	}
+	price := last.Ask
+	if action == domain.Sell {
+		price = last.Bid
+	}
+	b.muParameters.Lock()
+	book := b.book
+	b.muParameters.Unlock()
+	if book != nil {
+		vwap, err := book.VWAP(last.ProductId, action, float64(size))
+		if err == nil {
+			price = vwap
+		} else {
+			log.Warning("order book price: ", err)
+		}
+	}
+	if action == domain.Buy {
+		return price * (1 + float64(params.PriceSlipPercent)/100)
+	}
+	return price * (1 - float64(params.PriceSlipPercent)/100)
+}
+
+// instrument returns settings and model of the instrument
+func (b *Bot) instrument(symbol string) (InstrumentParameters, Predictor, bool) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	params, ok := b.instruments[symbolKey(symbol)]
+	model, found := b.models[symbolKey(symbol)]
+	if !found {
+		model = b.model
+	}
+	return params, model, ok
+}
+
+// StrategyCustom is the name of a strategy set by SetStrategy
+const StrategyCustom = "custom"
+
+// strategy returns the custom strategy of the instrument or the configured one with its name
+func (b *Bot) strategy(params InstrumentParameters, model Predictor) (Strategy, string) {
+	b.muParameters.Lock()
+	defer b.muParameters.Unlock()
+	if strategy, ok := b.strategies[symbolKey(params.Instrument)]; ok {
+		return strategy, StrategyCustom
+	}
+	name := params.Strategy.Name
+	if name == "" {
+		name = StrategyModel
+	}
+	return newStrategy(params, model), name
+}
+
+func (b *Bot) FetchOpenPositions(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, b.Parameters().Timeouts.ExchangeTimeout())
+	defer cancel()
+	resp, err := b.exchangeAPI.GetPositions(ctx)
 	if err != nil {
 		return err
 	}
@@ -158,18 +558,30 @@ func (b *Bot) FetchOpenPositions() error {
 	b.openPositions = make(map[string]int64)
 	for _, pos := range resp.OpenPositions {
 		if pos.Side == "long" {
-			b.openPositions[pos.Symbol] = pos.Size
+			b.openPositions[symbolKey(pos.Symbol)] = pos.Size
 		} else {
-			b.openPositions[pos.Symbol] = -pos.Size
+			b.openPositions[symbolKey(pos.Symbol)] = -pos.Size
 		}
 	}
+	b.setEntries(resp.OpenPositions)
+	b.risk.SetPositions(resp.OpenPositions)
 	log.Info("current open positions: ", b.openPositions)
 	return nil
 }
 
-func (b *Bot) ChangePosition(side domain.Action, size int64, price float64) error {
+func (b *Bot) ChangePosition(ctx context.Context, decision domain.Decision) error {
+	params, _, ok := b.instrument(decision.Symbol)
+	if !ok {
+		return fmt.Errorf("unknown instrument %q", decision.Symbol)
+	}
+	return b.changePosition(ctx, decision, params.orderType())
+}
+
+// changePosition sends the order of the decision, exits of stops cancel the
+// resting order of the instrument first
+func (b *Bot) changePosition(ctx context.Context, decision domain.Decision, orderType domain.OrderType) error {
 	var sign int64
-	switch side {
+	switch decision.Action {
 	case domain.None:
 		log.Info("action was not specified, position unchanged")
 		return nil
@@ -178,27 +590,59 @@ func (b *Bot) ChangePosition(side domain.Action, size int64, price float64) erro
 	case domain.Sell:
 		sign = -1
 	}
+	params, _, ok := b.instrument(decision.Symbol)
+	if !ok {
+		return fmt.Errorf("unknown instrument %q", decision.Symbol)
+	}
+	key := symbolKey(decision.Symbol)
 	b.muPositions.Lock()
 	defer b.muPositions.Unlock()
-	currentPos := b.openPositions[b.Instrument]
+	if r := b.activeResting(key); r != nil && (orderType == domain.PostType || decision.Trigger != "") {
+		// one resting order per instrument, its price is updated by replaceExpired
+		if r.order.Side == decision.Action && decision.Trigger == "" {
+			return nil
+		}
+		if _, err := b.cancelResting(ctx, r); err != nil {
+			return err
+		}
+	}
+	// resting orders may be filled later
+	currentPos := b.openPositions[key] + b.restingSize(key)
 	// keep position size within limits (-MaxPositionSize, +MaxPositionSize)
-	size = domain.Min(size, b.MaxPositionSize-sign*currentPos)
-	if size != 0 {
-		order := *domain.NewOrder(b.Instrument, side, domain.IocType, price, size)
-		resp, err := b.exchangeAPI.SendOrder(order)
+	size := domain.Min(decision.Size, params.MaxPositionSize-sign*currentPos)
+	if size > 0 {
+		order := *domain.NewOrder(decision.Symbol, decision.Action, orderType, decision.Price, size)
+		allowed, veto := b.risk.Evaluate(order, decision.Trigger != "")
+		if veto != nil {
+			veto.DecisionID = decision.ID
+			b.processVeto(*veto)
+		}
+		if allowed == 0 {
+			return nil
+		}
+		order.Quantity = float64(allowed)
+		metrics.OrdersSent.WithLabelValues(key, string(order.Side)).Inc()
+		ctx, cancel := context.WithTimeout(ctx, b.Parameters().Timeouts.ExchangeTimeout())
+		defer cancel()
+		resp, err := b.exchangeAPI.SendOrder(ctx, order)
 		if err != nil {
 			return err
 		}
-		actualAmount := b.processResponse(resp)
-		b.openPositions[b.Instrument] += sign * actualAmount
-		if b.openPositions[b.Instrument] == 0 {
-			delete(b.openPositions, b.Instrument)
+		actualAmount := b.processResponse(decision, order, resp)
+		b.openPositions[key] += sign * actualAmount
+		if b.openPositions[key] == 0 {
+			delete(b.openPositions, key)
+		}
+		if orderType == domain.PostType || orderType == domain.LmtType {
+			b.trackResting(decision, order, resp, actualAmount)
 		}
 	}
 	return nil
 }
 
-func (b *Bot) processResponse(resp *domain.SendOrderResponse) int64 {
+// processResponse notifies about the result of sending the order, stores all
+// order events and returns the executed amount
+func (b *Bot) processResponse(decision domain.Decision, order domain.Order, resp *domain.SendOrderResponse) int64 {
 	var message string
 	var amount int64
 	if resp.Result == domain.Error {
@@ -210,16 +654,28 @@ func (b *Bot) processResponse(resp *domain.SendOrderResponse) int64 {
 			log.Error(err)
 		}
 		message = buff.String()
-		// get filled amount, store to db
-		if resp.SendStatus.Status == "placed" {
-			event := resp.SendStatus.OrderEvents[0]
-			err := b.storage.StoreEvent(context.Background(), event)
-			if err != nil {
-				log.Error(err)
+		for _, event := range resp.SendStatus.OrderEvents {
+			if event.Type == domain.ExecutionEvent {
+				amount += event.Amount
+				b.risk.OnExecution(order.Symbol, order.Side, event.Amount, event.Price)
+				if order.Side == domain.Buy {
+					b.trackEntry(order.Symbol, event.Amount, event.Price)
+				} else {
+					b.trackEntry(order.Symbol, -event.Amount, event.Price)
+				}
 			}
-			amount = event.Amount
 		}
 	}
+	key := symbolKey(order.Symbol)
+	switch {
+	case amount > 0:
+		metrics.OrdersFilled.WithLabelValues(key, string(order.Side)).Inc()
+	case resp.Result == domain.Error:
+		metrics.OrdersRejected.WithLabelValues(key, *resp.Error).Inc()
+	default:
+		metrics.OrdersRejected.WithLabelValues(key, resp.SendStatus.Status).Inc()
+	}
+	b.storeEvents(decision, order, resp)
 	// send notification
 	err := b.notifier.Notify(message)
 	if err != nil {
@@ -229,22 +685,110 @@ func (b *Bot) processResponse(resp *domain.SendOrderResponse) int64 {
 	return amount
 }
 
-func (b *Bot) makeDecision(tickers []domain.Ticker) (domain.Action, error) {
-	// receive predicted value in range (0,1)
-	value, err := b.model.Predict(tickers...)
-	//log.Println("Predicted value:", value)
+// processVeto logs, notifies about and stores the order vetoed or reduced by the risk manager
+func (b *Bot) processVeto(veto domain.RiskVeto) {
+	metrics.RiskVetoes.WithLabelValues(symbolKey(veto.Order.Symbol), veto.Check).Inc()
+	var buff bytes.Buffer
+	if err := VetoTemplate.Execute(&buff, veto); err != nil {
+		log.Error(err)
+	}
+	message := buff.String()
+	log.Warning(message)
+	if err := b.notifier.Notify(message); err != nil {
+		log.Error(err)
+	}
+	if err := b.storage.StoreVeto(context.Background(), veto); err != nil {
+		metrics.StorageFailures.Inc()
+		log.Error(err)
+	}
+}
+
+// storeEvents stores every order event of the response. An order rejected
+// without events is stored as a REJECT event with the status as the reason.
+func (b *Bot) storeEvents(decision domain.Decision, order domain.Order, resp *domain.SendOrderResponse) {
+	events := resp.SendStatus.OrderEvents
+	if len(events) == 0 && resp.SendStatus.Status != "placed" {
+		reason := resp.SendStatus.Status
+		if resp.Result == domain.Error {
+			reason = *resp.Error
+		}
+		events = []domain.OrderEvent{{Type: domain.RejectEvent, Reason: reason, Order: &order}}
+	}
+	for _, event := range events {
+		record := domain.EventRecord{
+			DecisionID: decision.ID,
+			OrderID:    resp.SendStatus.OrderID,
+			Status:     resp.SendStatus.Status,
+			Trigger:    decision.Trigger,
+			OrderEvent: event,
+		}
+		if record.OrderID == "" && event.OrderInfo() != nil {
+			record.OrderID = event.OrderInfo().OrderID
+		}
+		b.storeEvent(record)
+	}
+}
+
+func (b *Bot) storeEvent(record domain.EventRecord) {
+	if err := b.storage.StoreEvent(context.Background(), record); err != nil {
+		metrics.StorageFailures.Inc()
+		log.Error(err)
+	}
+}
+
+func (b *Bot) makeDecision(ctx context.Context, params InstrumentParameters, strategy Strategy,
+	tickers []domain.Ticker) (Signal, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.Parameters().Timeouts.PredictTimeout())
+	defer cancel()
+	key := symbolKey(params.Instrument)
+	b.muPositions.Lock()
+	position := b.openPositions[key] + b.restingSize(key)
+	b.muPositions.Unlock()
+	signal, err := strategy.Decide(ctx, StrategyInput{Tickers: tickers, Position: position, Params: params})
 	if err != nil {
-		return domain.None, err
+		return Signal{Action: domain.None}, err
 	}
-	if value > b.DecisionThreshold {
-		return domain.Buy, nil
+	b.setPrediction(params.Instrument, signal.Value, signal.Source)
+	if signal.Source != "" {
+		metrics.PredictionSources.WithLabelValues(key, signal.Source).Inc()
+		log.Infof("%s: %s by model %s (%.4f)", key, signal.Action, signal.Source, signal.Value)
 	}
-	if value < 1-b.DecisionThreshold {
-		return domain.Sell, nil
+	return signal, nil
+}
+
+// drain reads the channel of a closed subscription until it's closed
+func drain(tickers <-chan domain.Ticker) {
+	for range tickers {
 	}
-	return domain.None, nil
 }
 
-func (b *Bot) Stop() {
-	close(b.shutdownChannel)
+func equalIDs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if symbolKey(a[i]) != symbolKey(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop stops a running bot, cancels calls in flight and waits until the
+// processing goroutines finish or ctx is done
+func (b *Bot) Stop(ctx context.Context) error {
+	if err := b.transition(StateStopping, StateRunning); err != nil {
+		return err
+	}
+	b.muState.Lock()
+	shutdown, once, cancel, done := b.shutdownChannel, b.shutdownOnce, b.cancel, b.done
+	b.muState.Unlock()
+	once.Do(func() { close(shutdown) })
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
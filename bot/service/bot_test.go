@@ -4,25 +4,32 @@ import (
 	"bot/domain"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 type ExchangeMock struct {
 	mock.Mock
 }
 
-func (exm *ExchangeMock) GetPositions() (*domain.OpenPositionsResponse, error) {
+func (exm *ExchangeMock) GetPositions(ctx context.Context) (*domain.OpenPositionsResponse, error) {
 	args := exm.Called()
 	return args.Get(0).(*domain.OpenPositionsResponse), args.Error(1)
 }
 
-func (exm *ExchangeMock) SendOrder(order domain.Order) (*domain.SendOrderResponse, error) {
+func (exm *ExchangeMock) SendOrder(ctx context.Context, order domain.Order) (*domain.SendOrderResponse, error) {
 	args := exm.Called(order)
 	return args.Get(0).(*domain.SendOrderResponse), args.Error(1)
 }
 
+func (exm *ExchangeMock) CancelOrder(ctx context.Context, orderID string) (*domain.CancelOrdersResponse, error) {
+	args := exm.Called(orderID)
+	return args.Get(0).(*domain.CancelOrdersResponse), args.Error(1)
+}
+
 func (exm *ExchangeMock) Subscribe(instruments ...string) (<-chan domain.Ticker, error) {
 	args := exm.Called(instruments)
 	return args.Get(0).(chan domain.Ticker), args.Error(1)
@@ -37,7 +44,7 @@ type PredictorMock struct {
 	mock.Mock
 }
 
-func (m *PredictorMock) Predict(tickers ...domain.Ticker) (float64, error) {
+func (m *PredictorMock) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
 	args := m.Called(tickers)
 	return args.Get(0).(float64), args.Error(1)
 }
@@ -46,8 +53,18 @@ type StorageMock struct {
 	mock.Mock
 }
 
-func (m *StorageMock) StoreEvent(ctx context.Context, event domain.OrderEvent) error {
-	args := m.Called(ctx, event)
+func (m *StorageMock) StoreEvent(ctx context.Context, record domain.EventRecord) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+func (m *StorageMock) StoreVeto(ctx context.Context, veto domain.RiskVeto) error {
+	args := m.Called(ctx, veto)
+	return args.Error(0)
+}
+
+func (m *StorageMock) StorePrediction(ctx context.Context, record domain.PredictionRecord) error {
+	args := m.Called(ctx, record)
 	return args.Error(0)
 }
 
@@ -69,7 +86,14 @@ func (m *NotifierMock) Notify(text string) error {
 	return args.Error(0)
 }
 
-var defaultParams = Parameters{"str", 100, 2, 0.5, 10, 1}
+var defaultParams = Parameters{InstrumentParameters: InstrumentParameters{
+	Instrument:        "PI_XBTUSD",
+	MaxPositionSize:   100,
+	OrderSize:         2,
+	DecisionThreshold: 0.5,
+	SequenceLength:    10,
+	PriceSlipPercent:  1,
+}}
 
 var openPosSample = `{
      "result":"success",
@@ -160,7 +184,7 @@ func TestBot_FetchOpenPositions(t *testing.T) {
 	json.Unmarshal([]byte(openPosSample), &openPos)
 	exm.On("GetPositions").Return(&openPos, nil)
 	var bot = New(&exm, &NotifierMock{}, &StorageMock{}, &PredictorMock{}, defaultParams)
-	err := bot.FetchOpenPositions()
+	err := bot.FetchOpenPositions(context.Background())
 	assert.Equal(t, err, nil)
 }
 
@@ -200,9 +224,339 @@ func TestBot_processSequence(t *testing.T) {
 	nm.On("Notify", mock.Anything).Return(nil)
 	sm := StorageMock{}
 	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	sm.On("StorePrediction", mock.Anything, mock.Anything).Return(nil)
 	pm := PredictorMock{}
 	pm.On("Predict", mock.Anything).Return(0.6, nil)
 	var bot = New(&exm, &nm, &sm, &pm, defaultParams)
-	err := bot.processSequence(tickers)
+	err := bot.processSequence(context.Background(), tickers)
 	assert.Equal(t, err, nil)
+	// the audit record is linked to the order events by the decision id
+	events := sm.Calls[0].Arguments.Get(1).(domain.EventRecord)
+	record := sm.Calls[len(sm.Calls)-1].Arguments.Get(1).(domain.PredictionRecord)
+	assert.Equal(t, events.DecisionID, record.DecisionID)
+	assert.Equal(t, StrategyModel, record.Strategy)
+	assert.Equal(t, 0.6, record.Value)
+	assert.Equal(t, defaultParams.DecisionThreshold, record.Threshold)
+	assert.Equal(t, domain.SequenceHash(tickers), record.SequenceHash)
+	assert.Equal(t, ticker.Time, record.SequenceTo)
+	assert.Len(t, record.Tickers, 2)
+	assert.Empty(t, record.Error)
+}
+
+func TestBot_Replay(t *testing.T) {
+	exm := ExchangeMock{}
+	var openPos domain.OpenPositionsResponse
+	json.Unmarshal([]byte(openPosSample), &openPos)
+	exm.On("GetPositions").Return(&openPos, nil)
+	var sendResp domain.SendOrderResponse
+	json.Unmarshal([]byte(sendOrderRespSample), &sendResp)
+	exm.On("SendOrder", mock.Anything).Return(&sendResp, nil)
+	var ticker domain.Ticker
+	json.Unmarshal([]byte(tickerSample), &ticker)
+	tape := make([]domain.Ticker, 25)
+	for i := range tape {
+		tape[i] = ticker
+	}
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	sm.On("StorePrediction", mock.Anything, mock.Anything).Return(nil)
+	pm := PredictorMock{}
+	pm.On("Predict", mock.Anything).Return(0.6, nil)
+	var bot = New(&exm, &nm, &sm, &pm, defaultParams)
+	consumed := 0
+	err := bot.Replay(context.Background(), tape, func(domain.Ticker) { consumed++ })
+	assert.Equal(t, err, nil)
+	assert.Equal(t, consumed, len(tape))
+	// sequences of length 10 are emitted on the 10th and 20th tickers
+	pm.AssertNumberOfCalls(t, "Predict", 2)
+}
+
+func TestBot_ReplayMultiInstrument(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	var xbt, eth domain.Ticker
+	json.Unmarshal([]byte(tickerSample), &xbt)
+	json.Unmarshal([]byte(tickerSample), &eth)
+	eth.ProductId = "PI_ETHUSD"
+	// interleaved feed: 3 tickers of each product
+	tape := []domain.Ticker{xbt, eth, xbt, eth, xbt, eth, xbt, eth}
+	pmXbt, pmEth := PredictorMock{}, PredictorMock{}
+	pmXbt.On("Predict", []domain.Ticker{xbt, xbt, xbt}).Return(0.5, nil)
+	pmEth.On("Predict", []domain.Ticker{eth, eth, eth}).Return(0.5, nil)
+	params := Parameters{
+		InstrumentParameters: InstrumentParameters{SequenceLength: 3, DecisionThreshold: 0.6},
+		Instruments:          []InstrumentParameters{{Instrument: "PI_XBTUSD"}, {Instrument: "PI_ETHUSD"}},
+	}
+	sm := StorageMock{}
+	sm.On("StorePrediction", mock.Anything, mock.Anything).Return(nil)
+	var bot = New(&exm, &NotifierMock{}, &sm, &pmXbt, params)
+	bot.SetModel("PI_ETHUSD", &pmEth)
+	err := bot.Replay(context.Background(), tape, nil)
+	assert.Equal(t, err, nil)
+	pmXbt.AssertNumberOfCalls(t, "Predict", 1)
+	pmEth.AssertNumberOfCalls(t, "Predict", 1)
+}
+
+func TestBot_ChangePositionStoresAllEvents(t *testing.T) {
+	exm := ExchangeMock{}
+	var sendResp domain.SendOrderResponse
+	json.Unmarshal([]byte(sendOrderRespSample), &sendResp)
+	// partial fill: second execution and cancellation of the rest
+	execution := sendResp.SendStatus.OrderEvents[0]
+	execution.Amount = 5
+	sendResp.SendStatus.OrderEvents = append(sendResp.SendStatus.OrderEvents, execution,
+		domain.OrderEvent{Type: domain.CancelEvent, Order: execution.ExecOrder})
+	exm.On("SendOrder", mock.Anything).Return(&sendResp, nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	var bot = New(&exm, &nm, &sm, &PredictorMock{}, defaultParams)
+	decision := domain.NewDecision("PI_XBTUSD", domain.Buy, 20, 7500)
+	err := bot.ChangePosition(context.Background(), *decision)
+	assert.Equal(t, err, nil)
+	sm.AssertNumberOfCalls(t, "StoreEvent", 3)
+	record := sm.Calls[2].Arguments.Get(1).(domain.EventRecord)
+	assert.Equal(t, decision.ID, record.DecisionID)
+	assert.Equal(t, "61ca5732-3478-42fe-8362-abbfd9465294", record.OrderID)
+	assert.Equal(t, domain.CancelEvent, record.Type)
+	assert.Equal(t, int64(15), bot.openPositions["pi_xbtusd"])
+}
+
+func TestBot_ChangePositionStoresReject(t *testing.T) {
+	exm := ExchangeMock{}
+	sendResp := domain.SendOrderResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}
+	sendResp.SendStatus.Status = "insufficientAvailableFunds"
+	exm.On("SendOrder", mock.Anything).Return(&sendResp, nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	var bot = New(&exm, &nm, &sm, &PredictorMock{}, defaultParams)
+	err := bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Sell, 2, 7500))
+	assert.Equal(t, err, nil)
+	record := sm.Calls[0].Arguments.Get(1).(domain.EventRecord)
+	assert.Equal(t, domain.RejectEvent, record.Type)
+	assert.Equal(t, "insufficientAvailableFunds", record.Reason)
+	assert.Equal(t, 0, len(bot.openPositions))
+}
+
+func TestBot_ChangeParameters(t *testing.T) {
+	var bot = New(&ExchangeMock{}, &NotifierMock{}, &StorageMock{}, &PredictorMock{}, defaultParams)
+	invalid := defaultParams
+	invalid.DecisionThreshold = 0.3
+	params, err := bot.ChangeParameters(invalid)
+	assert.ErrorIs(t, err, ErrInvalidParameters)
+	assert.Equal(t, defaultParams, params)
+
+	valid := defaultParams
+	valid.OrderSize = 5
+	params, err = bot.ChangeParameters(valid)
+	assert.Nil(t, err)
+	assert.Equal(t, valid, params)
+	inst, _, _ := bot.instrument("PI_XBTUSD")
+	assert.Equal(t, int64(5), inst.OrderSize)
+
+	// settings without kill_switch don't turn off the engaged switch
+	bot.SetKillSwitch(true)
+	params, err = bot.ChangeParameters(valid)
+	assert.Nil(t, err)
+	assert.True(t, params.Risk.KillSwitch)
+	bot.SetKillSwitch(false)
+	assert.False(t, bot.Parameters().Risk.KillSwitch)
+}
+
+func TestBot_ChangeParametersResubscribes(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	exm.On("Subscribe", []string{"PI_XBTUSD"}).Return(make(chan domain.Ticker), nil)
+	resubscribed := make(chan struct{})
+	exm.On("Subscribe", []string{"PI_ETHUSD"}).Return(make(chan domain.Ticker), nil).
+		Run(func(mock.Arguments) { close(resubscribed) })
+	exm.On("Unsubscribe").Return(nil)
+	nm := NotifierMock{}
+	nm.On("Start").Return(nil)
+	var bot = New(&exm, &nm, &StorageMock{}, &PredictorMock{}, defaultParams)
+	assert.Nil(t, bot.Start())
+	// same instrument: subscription is kept
+	params := defaultParams
+	params.SequenceLength = 20
+	_, err := bot.ChangeParameters(params)
+	assert.Nil(t, err)
+	params.Instrument = "PI_ETHUSD"
+	_, err = bot.ChangeParameters(params)
+	assert.Nil(t, err)
+	select {
+	case <-resubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("bot has not resubscribed")
+	}
+	exm.AssertNumberOfCalls(t, "Subscribe", 2)
+	assert.Nil(t, bot.Stop(context.Background()))
+}
+
+func waitForState(t *testing.T, bot *Bot, state State) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for bot.Status().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("state %s, want %s", bot.Status().State, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBot_Lifecycle(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	exm.On("Subscribe", mock.Anything).Return(make(chan domain.Ticker), nil)
+	exm.On("Unsubscribe").Return(nil)
+	nm := NotifierMock{}
+	nm.On("Start").Return(nil)
+	var bot = New(&exm, &nm, &StorageMock{}, &PredictorMock{}, defaultParams)
+	ctx := context.Background()
+	assert.ErrorIs(t, bot.Stop(ctx), ErrInvalidState)
+	assert.Nil(t, bot.Start())
+	assert.Equal(t, StateRunning, bot.Status().State)
+	assert.ErrorIs(t, bot.Start(), ErrInvalidState)
+	assert.Nil(t, bot.Stop(ctx))
+	assert.Equal(t, StateStopped, bot.Status().State)
+	assert.ErrorIs(t, bot.Stop(ctx), ErrInvalidState)
+	exm.AssertNumberOfCalls(t, "Subscribe", 1)
+	// can be started again
+	assert.Nil(t, bot.Start())
+	assert.Nil(t, bot.Stop(ctx))
+	assert.Equal(t, StateStopped, bot.Status().State)
+}
+
+// blockingPredictor waits until the call is canceled
+type blockingPredictor struct {
+	started chan struct{}
+}
+
+func (p blockingPredictor) Predict(ctx context.Context, tickers ...domain.Ticker) (float64, error) {
+	close(p.started)
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestBot_StopCancelsCalls(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	tickers := make(chan domain.Ticker)
+	exm.On("Subscribe", mock.Anything).Return(tickers, nil)
+	exm.On("Unsubscribe").Return(nil)
+	nm := NotifierMock{}
+	nm.On("Start").Return(nil)
+	model := blockingPredictor{make(chan struct{})}
+	params := defaultParams
+	params.SequenceLength = 1
+	params.Timeouts.Predict = "1h"
+	var bot = New(&exm, &nm, &StorageMock{}, model, params)
+	assert.Nil(t, bot.Start())
+	var ticker domain.Ticker
+	json.Unmarshal([]byte(tickerSample), &ticker)
+	tickers <- ticker
+	tickers <- ticker
+	<-model.started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, bot.Stop(ctx))
+	status := bot.Status()
+	assert.Equal(t, StateStopped, status.State)
+	assert.Empty(t, status.LastError)
+}
+
+func TestBot_ProcessingErrorFails(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	tickers := make(chan domain.Ticker)
+	exm.On("Subscribe", mock.Anything).Return(tickers, nil)
+	exm.On("Unsubscribe").Return(nil)
+	nm := NotifierMock{}
+	nm.On("Start").Return(nil)
+	pm := PredictorMock{}
+	pm.On("Predict", mock.Anything).Return(0.0, errors.New("model is unavailable"))
+	params := defaultParams
+	params.SequenceLength = 1
+	sm := StorageMock{}
+	sm.On("StorePrediction", mock.Anything, mock.Anything).Return(nil)
+	var bot = New(&exm, &nm, &sm, &pm, params)
+	assert.Nil(t, bot.Start())
+	var ticker domain.Ticker
+	json.Unmarshal([]byte(tickerSample), &ticker)
+	// a sequence of length 1 is emitted on the first ticker, the failure stops reading the feed
+	tickers <- ticker
+	waitForState(t, bot, StateFailed)
+	status := bot.Status()
+	assert.Contains(t, status.LastError, "model is unavailable")
+	assert.NotNil(t, status.LastTickerTime)
+	// failed predictions are audited too
+	sm.AssertCalled(t, "StorePrediction", mock.Anything, mock.MatchedBy(func(record domain.PredictionRecord) bool {
+		return record.Error == "model is unavailable" && record.Action == domain.None
+	}))
+}
+
+type bookStub struct {
+	size     float64
+	products []string
+}
+
+func (b *bookStub) VWAP(productID string, side domain.Action, size float64) (float64, error) {
+	b.size = size
+	return 100, nil
+}
+
+func (b *bookStub) SetProducts(productIDs ...string) {
+	b.products = productIDs
+}
+
+func TestBot_ChangeParametersOrderBook(t *testing.T) {
+	book := &bookStub{}
+	bot := New(&ExchangeMock{}, &NotifierMock{}, &StorageMock{}, &PredictorMock{}, defaultParams)
+	bot.SetOrderBook(book)
+	params := defaultParams
+	params.OrderSize = 5
+	_, err := bot.ChangeParameters(params)
+	assert.Nil(t, err)
+	assert.Nil(t, book.products)
+
+	eth := defaultParams.InstrumentParameters
+	eth.Instrument = "PI_ETHUSD"
+	params.Instruments = []InstrumentParameters{defaultParams.InstrumentParameters, eth}
+	_, err = bot.ChangeParameters(params)
+	assert.Nil(t, err)
+	assert.Equal(t, params.InstrumentIDs(), book.products)
+}
+
+func TestBot_LimitPriceOrderSize(t *testing.T) {
+	book := &bookStub{}
+	bot := New(&ExchangeMock{}, &NotifierMock{}, &StorageMock{}, &PredictorMock{}, defaultParams)
+	bot.SetOrderBook(book)
+	// the book is walked for the size of the order, not order_size
+	price := bot.limitPrice(defaultParams.InstrumentParameters, domain.Buy, 7, domain.Ticker{ProductId: "PI_XBTUSD", Ask: 99})
+	assert.Equal(t, 7.0, book.size)
+	assert.InDelta(t, 100*(1+float64(defaultParams.PriceSlipPercent)/100), price, 1e-9)
+}
+
+func TestBot_FeedClosedAtStart(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("GetPositions").Return(&domain.OpenPositionsResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}, nil)
+	closed := make(chan domain.Ticker)
+	close(closed)
+	exm.On("Subscribe", mock.Anything).Return(closed, nil)
+	exm.On("Unsubscribe").Return(nil)
+	nm := NotifierMock{}
+	nm.On("Start").Return(nil)
+	var bot = New(&exm, &nm, &StorageMock{}, &PredictorMock{}, defaultParams)
+	assert.Nil(t, bot.Start())
+	// the failure is not overwritten by Start
+	waitForState(t, bot, StateFailed)
+	assert.Equal(t, ErrFeedClosed.Error(), bot.Status().LastError)
+	assert.ErrorIs(t, bot.Stop(context.Background()), ErrInvalidState)
+	// can be started again
+	assert.Nil(t, bot.Start())
+	waitForState(t, bot, StateFailed)
 }
@@ -9,6 +9,9 @@ const NotificationTempl = `{{- $status := .Status -}}
 {{- if  eq .Type "EXECUTION" -}}
 *The order has been EXECUTED*:
 {{.ExecOrder.Side}} {{.Amount}} *{{.ExecOrder.Symbol}}* at {{.Price}}
+{{- else if eq .Type "PLACE" -}}
+*The order has been PLACED*:
+{{.Order.Side}} {{.Order.Quantity}} *{{.Order.Symbol}}* at {{.Order.LimitPrice}}
 {{- else -}}
 *The order has been CANCELED:*
 {{.Order.Side}} {{.Order.Quantity}} *{{.Order.Symbol}}* at {{.Order.LimitPrice}}
@@ -22,3 +25,14 @@ Status: {{$status}}
 {{- end -}}`
 
 var NotificationTemplate = template.Must(template.New("notification").Parse(NotificationTempl))
+
+const VetoTempl = `{{- if .AllowedSize -}}
+*The order has been REDUCED by risk check* {{.Check}}:
+{{.Order.Side}} {{.AllowedSize}} of {{.Order.Quantity}} *{{.Order.Symbol}}* at {{.Order.LimitPrice}}
+{{- else -}}
+*The order has been VETOED by risk check* {{.Check}}:
+{{.Order.Side}} {{.Order.Quantity}} *{{.Order.Symbol}}* at {{.Order.LimitPrice}}
+{{- end}}
+Reason: {{.Reason}}`
+
+var VetoTemplate = template.Must(template.New("veto").Parse(VetoTempl))
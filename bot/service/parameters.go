@@ -0,0 +1,296 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// Default deadlines of the calls made while trading
+const (
+	DefaultPredictTimeout  = 5 * time.Second
+	DefaultExchangeTimeout = 10 * time.Second
+	DefaultRestingTimeout  = 30 * time.Second
+)
+
+// Execution styles
+const (
+	ExecutionIOC      = "ioc"       // IOC limit order at the ticker or book price with the price slip
+	ExecutionMarket   = "market"    // market order
+	ExecutionPostOnly = "post_only" // resting post-only order at the best price, replaced after resting_timeout
+)
+
+// InstrumentParameters are trading settings of a single instrument
+type InstrumentParameters struct {
+	Instrument        string  `yaml:"instrument" json:"instrument"`
+	MaxPositionSize   int64   `yaml:"max_position_size" json:"max_position_size"`
+	OrderSize         int64   `yaml:"order_size" json:"order_size"`
+	DecisionThreshold float64 `yaml:"decision_threshold" json:"decision_threshold"`
+	SequenceLength    int     `yaml:"sequence_length" json:"sequence_length"`
+	PriceSlipPercent  int64   `yaml:"price_slip_percent" json:"price_slip_percent"`
+	ModelURL          string  `yaml:"model_url" json:"model_url,omitempty"` // default model is used if empty
+	Execution         string  `yaml:"execution" json:"execution,omitempty"` // ioc if empty
+	RestingTimeout    string  `yaml:"resting_timeout" json:"resting_timeout,omitempty"`
+	// exits of open positions in % of the entry price, 0 disables
+	StopLossPercent     float64        `yaml:"stop_loss_percent" json:"stop_loss_percent,omitempty"`
+	TakeProfitPercent   float64        `yaml:"take_profit_percent" json:"take_profit_percent,omitempty"`
+	TrailingStopPercent float64        `yaml:"trailing_stop_percent" json:"trailing_stop_percent,omitempty"` // from the best price since entry
+	Strategy            StrategyConfig `yaml:"strategy" json:"strategy"`
+	// sliding window: a sequence every sequence_stride samples, sequence_length if 0
+	SequenceStride int `yaml:"sequence_stride" json:"sequence_stride,omitempty"`
+	// samples are the last tickers of fixed intervals like "5s", every ticker if empty
+	SequenceInterval string `yaml:"sequence_interval" json:"sequence_interval,omitempty"`
+}
+
+// Strategies
+const (
+	StrategyModel         = "model"          // threshold of the model prediction
+	StrategyMACrossover   = "ma_crossover"   // fast and slow moving averages of the mid price
+	StrategyMeanReversion = "mean_reversion" // z-score of the mid price filtered by the bid/ask spread
+)
+
+// StrategyConfig selects and configures the strategy, model if empty
+type StrategyConfig struct {
+	Name string `yaml:"name" json:"name,omitempty"`
+	// ma_crossover: periods in tickers
+	FastPeriod int `yaml:"fast_period" json:"fast_period,omitempty"`
+	SlowPeriod int `yaml:"slow_period" json:"slow_period,omitempty"`
+	// mean_reversion
+	Window           int     `yaml:"window" json:"window,omitempty"`   // tickers of the mean, the whole sequence if 0
+	EntryZ           float64 `yaml:"entry_z" json:"entry_z,omitempty"` // DefaultEntryZ if 0
+	MaxSpreadPercent float64 `yaml:"max_spread_percent" json:"max_spread_percent,omitempty"`
+}
+
+func (c StrategyConfig) isModel() bool {
+	return c.Name == "" || c.Name == StrategyModel
+}
+
+func (p InstrumentParameters) orderType() domain.OrderType {
+	switch p.Execution {
+	case ExecutionMarket:
+		return domain.MktType
+	case ExecutionPostOnly:
+		return domain.PostType
+	}
+	return domain.IocType
+}
+
+func (p InstrumentParameters) restingTimeout() time.Duration {
+	return duration(p.RestingTimeout, DefaultRestingTimeout)
+}
+
+func (p InstrumentParameters) sequenceInterval() time.Duration {
+	return duration(p.SequenceInterval, 0)
+}
+
+type Parameters struct {
+	// settings of the single instrument, defaults for the instruments list
+	InstrumentParameters `yaml:",inline"`
+	Instruments          []InstrumentParameters `yaml:"instruments" json:"instruments,omitempty"`
+	Risk                 RiskLimits             `yaml:"risk" json:"risk"`
+	Timeouts             Timeouts               `yaml:"timeouts" json:"timeouts"`
+}
+
+// Timeouts are per-request deadlines like "5s", defaults are used if empty
+type Timeouts struct {
+	Predict  string `yaml:"predict" json:"predict,omitempty"`
+	Exchange string `yaml:"exchange" json:"exchange,omitempty"` // send order, get positions
+}
+
+func (t Timeouts) PredictTimeout() time.Duration {
+	return duration(t.Predict, DefaultPredictTimeout)
+}
+
+func (t Timeouts) ExchangeTimeout() time.Duration {
+	return duration(t.Exchange, DefaultExchangeTimeout)
+}
+
+func (t Timeouts) Validate() error {
+	for _, value := range []string{t.Predict, t.Exchange} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("%w: timeout %q must be a positive duration", ErrInvalidParameters, value)
+		}
+	}
+	return nil
+}
+
+func duration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+var ErrInvalidParameters = errors.New("invalid parameters")
+
+// Validate checks settings of every instrument
+func (p Parameters) Validate() error {
+	if p.Risk.MaxDailyLoss < 0 || p.Risk.MaxOrdersPerMinute < 0 ||
+		p.Risk.MaxNotional < 0 || p.Risk.MaxPriceDeviationPercent < 0 {
+		return fmt.Errorf("%w: risk limits must not be negative", ErrInvalidParameters)
+	}
+	if err := p.Timeouts.Validate(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, inst := range p.InstrumentList() {
+		if err := inst.Validate(); err != nil {
+			return err
+		}
+		if seen[symbolKey(inst.Instrument)] {
+			return fmt.Errorf("%w: duplicate instrument %s", ErrInvalidParameters, inst.Instrument)
+		}
+		seen[symbolKey(inst.Instrument)] = true
+	}
+	return nil
+}
+
+func (p InstrumentParameters) Validate() error {
+	switch {
+	case p.Instrument == "":
+		return fmt.Errorf("%w: instrument is not set", ErrInvalidParameters)
+	case p.OrderSize <= 0:
+		return fmt.Errorf("%w: %s: order_size must be positive", ErrInvalidParameters, p.Instrument)
+	case p.MaxPositionSize < 0:
+		return fmt.Errorf("%w: %s: max_position_size must not be negative", ErrInvalidParameters, p.Instrument)
+	case p.Strategy.isModel() && (p.DecisionThreshold < 0.5 || p.DecisionThreshold >= 1):
+		return fmt.Errorf("%w: %s: decision_threshold must be in [0.5, 1)", ErrInvalidParameters, p.Instrument)
+	case p.SequenceLength <= 0:
+		return fmt.Errorf("%w: %s: sequence_length must be positive", ErrInvalidParameters, p.Instrument)
+	case p.PriceSlipPercent < 0 || p.PriceSlipPercent >= 100:
+		return fmt.Errorf("%w: %s: price_slip_percent must be in [0, 100)", ErrInvalidParameters, p.Instrument)
+	case p.Execution != "" && p.Execution != ExecutionIOC && p.Execution != ExecutionMarket && p.Execution != ExecutionPostOnly:
+		return fmt.Errorf("%w: %s: unknown execution %q", ErrInvalidParameters, p.Instrument, p.Execution)
+	case p.StopLossPercent < 0 || p.StopLossPercent >= 100:
+		return fmt.Errorf("%w: %s: stop_loss_percent must be in [0, 100)", ErrInvalidParameters, p.Instrument)
+	case p.TakeProfitPercent < 0:
+		return fmt.Errorf("%w: %s: take_profit_percent must not be negative", ErrInvalidParameters, p.Instrument)
+	case p.TrailingStopPercent < 0 || p.TrailingStopPercent >= 100:
+		return fmt.Errorf("%w: %s: trailing_stop_percent must be in [0, 100)", ErrInvalidParameters, p.Instrument)
+	}
+	if err := p.validateStrategy(); err != nil {
+		return err
+	}
+	if p.SequenceStride < 0 {
+		return fmt.Errorf("%w: %s: sequence_stride must not be negative", ErrInvalidParameters, p.Instrument)
+	}
+	if p.SequenceInterval != "" {
+		if d, err := time.ParseDuration(p.SequenceInterval); err != nil || d <= 0 {
+			return fmt.Errorf("%w: %s: sequence_interval must be a positive duration", ErrInvalidParameters, p.Instrument)
+		}
+	}
+	if p.RestingTimeout != "" {
+		if d, err := time.ParseDuration(p.RestingTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("%w: %s: resting_timeout must be a positive duration", ErrInvalidParameters, p.Instrument)
+		}
+	}
+	return nil
+}
+
+// validateStrategy checks the strategy settings against the sequence length
+func (p InstrumentParameters) validateStrategy() error {
+	c := p.Strategy
+	switch c.Name {
+	case "", StrategyModel:
+	case StrategyMACrossover:
+		if c.FastPeriod <= 0 || c.SlowPeriod <= c.FastPeriod || c.SlowPeriod > p.SequenceLength {
+			return fmt.Errorf("%w: %s: ma_crossover periods must be 0 < fast_period < slow_period <= sequence_length",
+				ErrInvalidParameters, p.Instrument)
+		}
+	case StrategyMeanReversion:
+		if c.Window < 0 || c.Window == 1 || c.Window > p.SequenceLength {
+			return fmt.Errorf("%w: %s: mean_reversion window must be in [2, sequence_length]", ErrInvalidParameters, p.Instrument)
+		}
+		if c.EntryZ < 0 || c.MaxSpreadPercent < 0 {
+			return fmt.Errorf("%w: %s: entry_z and max_spread_percent must not be negative", ErrInvalidParameters, p.Instrument)
+		}
+	default:
+		return fmt.Errorf("%w: %s: unknown strategy %q", ErrInvalidParameters, p.Instrument, c.Name)
+	}
+	return nil
+}
+
+// InstrumentList returns settings of all traded instruments,
+// unset fields of the list entries are taken from the top level settings
+func (p Parameters) InstrumentList() []InstrumentParameters {
+	if len(p.Instruments) == 0 {
+		return []InstrumentParameters{p.InstrumentParameters}
+	}
+	list := make([]InstrumentParameters, 0, len(p.Instruments))
+	for _, inst := range p.Instruments {
+		if inst.MaxPositionSize == 0 {
+			inst.MaxPositionSize = p.MaxPositionSize
+		}
+		if inst.OrderSize == 0 {
+			inst.OrderSize = p.OrderSize
+		}
+		if inst.DecisionThreshold == 0 {
+			inst.DecisionThreshold = p.DecisionThreshold
+		}
+		if inst.SequenceLength == 0 {
+			inst.SequenceLength = p.SequenceLength
+		}
+		if inst.PriceSlipPercent == 0 {
+			inst.PriceSlipPercent = p.PriceSlipPercent
+		}
+		if inst.ModelURL == "" {
+			inst.ModelURL = p.ModelURL
+		}
+		if inst.Execution == "" {
+			inst.Execution = p.Execution
+		}
+		if inst.RestingTimeout == "" {
+			inst.RestingTimeout = p.RestingTimeout
+		}
+		if inst.StopLossPercent == 0 {
+			inst.StopLossPercent = p.StopLossPercent
+		}
+		if inst.TakeProfitPercent == 0 {
+			inst.TakeProfitPercent = p.TakeProfitPercent
+		}
+		if inst.TrailingStopPercent == 0 {
+			inst.TrailingStopPercent = p.TrailingStopPercent
+		}
+		if inst.Strategy.Name == "" {
+			inst.Strategy = p.Strategy
+		}
+		if inst.SequenceStride == 0 {
+			inst.SequenceStride = p.SequenceStride
+		}
+		if inst.SequenceInterval == "" {
+			inst.SequenceInterval = p.SequenceInterval
+		}
+		list = append(list, inst)
+	}
+	return list
+}
+
+// InstrumentIDs returns product ids of all traded instruments
+func (p Parameters) InstrumentIDs() []string {
+	list := p.InstrumentList()
+	ids := make([]string, 0, len(list))
+	for _, inst := range list {
+		ids = append(ids, inst.Instrument)
+	}
+	return ids
+}
+
+func (p Parameters) instrumentMap() map[string]InstrumentParameters {
+	m := make(map[string]InstrumentParameters)
+	for _, inst := range p.InstrumentList() {
+		m[symbolKey(inst.Instrument)] = inst
+	}
+	return m
+}
+
+// symbolKey normalizes symbols: Kraken uses upper case product ids in feeds
+// and lower case symbols in rest responses
+func symbolKey(symbol string) string {
+	return strings.ToLower(symbol)
+}
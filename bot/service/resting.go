@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// fillsGrace is how long fills of canceled orders and fills received before
+// the order response are kept
+const fillsGrace = time.Minute
+
+// restingOrder is a placed limit order waiting for fills
+type restingOrder struct {
+	order      domain.Order // Quantity is the unfilled remainder
+	decisionID string
+	placedAt   time.Time       // time of the instrument quote
+	fills      map[string]bool // counted execution ids
+	canceledAt time.Time       // zero while the order is active, then late fills are still counted
+}
+
+// OnFills updates positions with fills of resting orders reported by the
+// exchange (the fills feed), fills of other orders are ignored
+func (b *Bot) OnFills(fills []domain.Fill) {
+	b.muPositions.Lock()
+	defer b.muPositions.Unlock()
+	now := time.Now()
+	for _, fill := range fills {
+		r, ok := b.resting[fill.OrderID]
+		if !ok {
+			// the response of the order may still be on the way
+			if fill.Time == 0 {
+				fill.Time = now.UnixNano() / int64(time.Millisecond)
+			}
+			b.unmatchedFills[fill.OrderID] = append(b.unmatchedFills[fill.OrderID], fill)
+			continue
+		}
+		b.applyFill(r, fill)
+	}
+	for orderID, fills := range b.unmatchedFills {
+		if now.Sub(time.Unix(0, fills[0].Time*int64(time.Millisecond))) > fillsGrace {
+			delete(b.unmatchedFills, orderID)
+		}
+	}
+}
+
+// trackResting starts tracking the remainder of a placed limit order,
+// must be called with muPositions locked
+func (b *Bot) trackResting(decision domain.Decision, order domain.Order, resp *domain.SendOrderResponse, executed int64) {
+	remaining := int64(order.Quantity) - executed
+	if resp.Result != domain.Success || resp.SendStatus.Status != "placed" ||
+		resp.SendStatus.OrderID == "" || remaining <= 0 {
+		return
+	}
+	r := &restingOrder{
+		order:      order,
+		decisionID: decision.ID,
+		placedAt:   b.quoteTime(order.Symbol),
+		fills:      make(map[string]bool),
+	}
+	r.order.OrderID = resp.SendStatus.OrderID
+	r.order.Quantity = float64(remaining)
+	for _, event := range resp.SendStatus.OrderEvents {
+		if event.Type == domain.ExecutionEvent {
+			r.fills[event.ExecutionID] = true
+		}
+	}
+	b.resting[r.order.OrderID] = r
+	log.Infof("resting order %s: %s %d %s @ %.2f", r.order.OrderID, r.order.Side, remaining, r.order.Symbol, r.order.LimitPrice)
+	for _, fill := range b.unmatchedFills[r.order.OrderID] {
+		b.applyFill(r, fill)
+	}
+	delete(b.unmatchedFills, r.order.OrderID)
+}
+
+// applyFill must be called with muPositions locked
+func (b *Bot) applyFill(r *restingOrder, fill domain.Fill) {
+	if r.fills[fill.FillID] {
+		return
+	}
+	r.fills[fill.FillID] = true
+	amount := int64(fill.Qty)
+	key := symbolKey(r.order.Symbol)
+	sign := int64(1)
+	if r.order.Side == domain.Sell {
+		sign = -1
+	}
+	b.openPositions[key] += sign * amount
+	if b.openPositions[key] == 0 {
+		delete(b.openPositions, key)
+	}
+	r.order.Quantity -= float64(amount)
+	if r.order.Quantity <= 0 {
+		delete(b.resting, r.order.OrderID)
+	}
+	b.risk.OnExecution(r.order.Symbol, r.order.Side, amount, fill.Price)
+	b.trackEntry(r.order.Symbol, sign*amount, fill.Price)
+	metrics.OrdersFilled.WithLabelValues(key, string(r.order.Side)).Inc()
+	order := r.order
+	order.TS = b.quoteTime(order.Symbol)
+	if fill.Time > 0 {
+		order.TS = time.Unix(0, fill.Time*int64(time.Millisecond))
+	}
+	b.storeEvent(domain.EventRecord{
+		DecisionID: r.decisionID,
+		OrderID:    order.OrderID,
+		Status:     "filled",
+		OrderEvent: domain.OrderEvent{
+			Type:        domain.ExecutionEvent,
+			ExecutionID: fill.FillID,
+			Price:       fill.Price,
+			Amount:      amount,
+			ExecOrder:   &order,
+		},
+	})
+	message := fmt.Sprintf("resting order filled: %s %d %s @ %.2f", order.Side, amount, order.Symbol, fill.Price)
+	if err := b.notifier.Notify(message); err != nil {
+		log.Error(err)
+	}
+	log.Info(message)
+}
+
+// activeResting returns the not canceled resting order of the instrument,
+// must be called with muPositions locked
+func (b *Bot) activeResting(key string) *restingOrder {
+	for _, r := range b.resting {
+		if r.canceledAt.IsZero() && symbolKey(r.order.Symbol) == key {
+			return r
+		}
+	}
+	return nil
+}
+
+// restingSize returns the signed unfilled size of active resting orders,
+// must be called with muPositions locked
+func (b *Bot) restingSize(key string) int64 {
+	var size int64
+	for _, r := range b.resting {
+		if !r.canceledAt.IsZero() || symbolKey(r.order.Symbol) != key {
+			continue
+		}
+		if r.order.Side == domain.Buy {
+			size += int64(r.order.Quantity)
+		} else {
+			size -= int64(r.order.Quantity)
+		}
+	}
+	return size
+}
+
+// cancelResting cancels the order on the exchange and returns the cancel status,
+// must be called with muPositions locked
+func (b *Bot) cancelResting(ctx context.Context, r *restingOrder) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.Parameters().Timeouts.ExchangeTimeout())
+	defer cancel()
+	resp, err := b.exchangeAPI.CancelOrder(ctx, r.order.OrderID)
+	if err != nil {
+		return "", err
+	}
+	if resp.Result != domain.Success {
+		return "", fmt.Errorf("cancel order %s failed: %s", r.order.OrderID, *resp.Error)
+	}
+	// filled or canceled already if not found
+	r.canceledAt = b.quoteTime(r.order.Symbol)
+	for _, event := range resp.CancelStatus.OrderEvents {
+		b.storeEvent(domain.EventRecord{
+			DecisionID: r.decisionID,
+			OrderID:    r.order.OrderID,
+			Status:     resp.CancelStatus.Status,
+			OrderEvent: event,
+		})
+	}
+	log.Infof("resting order %s: %s", r.order.OrderID, resp.CancelStatus.Status)
+	return resp.CancelStatus.Status, nil
+}
+
+// replaceExpired cancels resting orders older than resting_timeout and places
+// the remainder again at the current price. The age is measured by the quotes of
+// the instrument, the same clock as placedAt and canceledAt, so replays and
+// lagging feeds expire orders by the market time.
+func (b *Bot) replaceExpired(ctx context.Context) error {
+	var replace []domain.Decision
+	b.muPositions.Lock()
+	ids := make([]string, 0, len(b.resting))
+	for id := range b.resting {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return b.resting[ids[i]].placedAt.Before(b.resting[ids[j]].placedAt) })
+	for _, id := range ids {
+		r := b.resting[id]
+		now := b.quoteTime(r.order.Symbol)
+		if !r.canceledAt.IsZero() {
+			if now.Sub(r.canceledAt) > fillsGrace {
+				delete(b.resting, id)
+			}
+			continue
+		}
+		params, _, ok := b.instrument(r.order.Symbol)
+		if ok && now.Sub(r.placedAt) < params.restingTimeout() {
+			continue
+		}
+		status, err := b.cancelResting(ctx, r)
+		if err != nil {
+			b.muPositions.Unlock()
+			return err
+		}
+		quote, found := b.quote(r.order.Symbol)
+		if !ok || !found || status != "cancelled" || r.order.Quantity <= 0 {
+			continue
+		}
+		size := int64(r.order.Quantity)
+		decision := domain.NewDecision(r.order.Symbol, r.order.Side, size, b.limitPrice(params, r.order.Side, size, quote))
+		decision.ID = r.decisionID
+		replace = append(replace, *decision)
+	}
+	b.muPositions.Unlock()
+	for _, decision := range replace {
+		if err := b.ChangePosition(ctx, decision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteTime is the time of the last quote of the instrument, the current time if unknown
+func (b *Bot) quoteTime(symbol string) time.Time {
+	if quote, ok := b.quote(symbol); ok && quote.Time > 0 {
+		return tickerTime(quote)
+	}
+	return time.Now()
+}
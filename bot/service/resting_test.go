@@ -0,0 +1,86 @@
+package service
+
+import (
+	"bot/domain"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func placedResponse(orderID string) *domain.SendOrderResponse {
+	resp := &domain.SendOrderResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}
+	resp.SendStatus = domain.Status{OrderID: orderID, Status: "placed", OrderEvents: []domain.OrderEvent{{Type: domain.PlaceEvent}}}
+	return resp
+}
+
+func TestBot_PostOnlyFills(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("SendOrder", mock.MatchedBy(func(order domain.Order) bool { return order.Type == domain.PostType })).
+		Return(placedResponse("order-1"), nil).Once()
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	params := defaultParams
+	params.Execution = ExecutionPostOnly
+	bot := New(&exm, &nm, &sm, &PredictorMock{}, params)
+
+	// a fill may come before the order response
+	bot.OnFills([]domain.Fill{{OrderID: "order-1", FillID: "fill-1", Qty: 1, Price: 100, Buy: true}})
+	err := bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), bot.Status().Positions["pi_xbtusd"])
+	// same side decision keeps the resting order
+	err = bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 101))
+	assert.Nil(t, err)
+	exm.AssertNumberOfCalls(t, "SendOrder", 1)
+
+	bot.OnFills([]domain.Fill{
+		{OrderID: "order-1", FillID: "fill-1", Qty: 1, Price: 100, Buy: true}, // duplicate
+		{OrderID: "order-1", FillID: "fill-2", Qty: 1, Price: 100, Buy: true, Time: 1612270825000},
+		{OrderID: "other", FillID: "fill-3", Qty: 5, Price: 100, Buy: true},
+	})
+	assert.Equal(t, int64(2), bot.Status().Positions["pi_xbtusd"])
+	assert.Empty(t, bot.resting)
+	// executions are stored at the time of the fill
+	sm.AssertCalled(t, "StoreEvent", mock.Anything, mock.MatchedBy(func(record domain.EventRecord) bool {
+		return record.ExecutionID == "fill-2" && record.ExecOrder.TS.Equal(time.Unix(1612270825, 0))
+	}))
+}
+
+func TestBot_ReplaceExpired(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("SendOrder", mock.Anything).Return(placedResponse("order-1"), nil).Once()
+	exm.On("SendOrder", mock.Anything).Return(placedResponse("order-2"), nil).Once()
+	exm.On("CancelOrder", "order-1").Return(&domain.CancelOrdersResponse{
+		BaseResponse: domain.BaseResponse{Result: domain.Success},
+		CancelStatus: domain.Status{Status: "cancelled"},
+	}, nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	params := defaultParams
+	params.Execution = ExecutionPostOnly
+	params.RestingTimeout = "10s"
+	bot := New(&exm, &nm, &sm, &PredictorMock{}, params)
+	start := time.Unix(1612270825, 0)
+	bot.setQuote(domain.Ticker{ProductId: "PI_XBTUSD", Time: start.UnixNano() / int64(time.Millisecond), Bid: 100, Ask: 101})
+
+	err := bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 100))
+	assert.Nil(t, err)
+	bot.setQuote(domain.Ticker{ProductId: "PI_XBTUSD", Time: start.Add(5*time.Second).UnixNano() / int64(time.Millisecond), Bid: 100, Ask: 101})
+	assert.Nil(t, bot.replaceExpired(context.Background()))
+	exm.AssertNumberOfCalls(t, "CancelOrder", 0)
+
+	bot.setQuote(domain.Ticker{ProductId: "PI_XBTUSD", Time: start.Add(11*time.Second).UnixNano() / int64(time.Millisecond), Bid: 102, Ask: 103})
+	assert.Nil(t, bot.replaceExpired(context.Background()))
+	exm.AssertNumberOfCalls(t, "CancelOrder", 1)
+	exm.AssertNumberOfCalls(t, "SendOrder", 2)
+	replaced := exm.Calls[len(exm.Calls)-1].Arguments.Get(0).(domain.Order)
+	assert.Equal(t, 102.0, replaced.LimitPrice)
+	assert.Equal(t, 2.0, replaced.Quantity)
+	assert.NotNil(t, bot.resting["order-2"])
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// RiskLimits are settings of the built-in risk checks, zero value disables a check
+type RiskLimits struct {
+	MaxDailyLoss             float64 `yaml:"max_daily_loss" json:"max_daily_loss"`
+	MaxOrdersPerMinute       int     `yaml:"max_orders_per_minute" json:"max_orders_per_minute"`
+	MaxNotional              float64 `yaml:"max_notional" json:"max_notional"`
+	MaxPriceDeviationPercent float64 `yaml:"max_price_deviation_percent" json:"max_price_deviation_percent"`
+	KillSwitch               bool    `yaml:"kill_switch" json:"kill_switch"`
+}
+
+// RiskContext is the trading state an order is checked against
+type RiskContext struct {
+	Limits           RiskLimits
+	Positions        map[string]int64   // by lower case symbol
+	LastPrices       map[string]float64 // by lower case symbol
+	DailyPnL         float64            // realized and unrealized P&L since 00:00 UTC
+	OrdersLastMinute int
+	Exit             bool // the order is an exit of a triggered stop
+}
+
+// RiskCheck inspects an order before it is sent. It returns the allowed size,
+// which is less than the order quantity to reduce it and 0 to veto it.
+type RiskCheck interface {
+	Name() string
+	Check(order domain.Order, ctx RiskContext) (allowed int64, reason string)
+}
+
+// RiskManager runs risk checks and tracks the state they need
+type RiskManager struct {
+	mu          sync.Mutex
+	limits      RiskLimits
+	checks      []RiskCheck
+	positions   map[string]*domain.CostBasis
+	lastPrices  map[string]float64
+	day         string
+	realizedPnL float64            // since the start of the day
+	dayStart    map[string]float64 // marks of the positions open at the start of the day
+	orders      []time.Time
+}
+
+func NewRiskManager(limits RiskLimits) *RiskManager {
+	return &RiskManager{
+		limits: limits,
+		checks: []RiskCheck{
+			killSwitch{},
+			dailyLoss{},
+			orderRate{},
+			priceDeviation{},
+			notional{},
+		},
+		positions:  make(map[string]*domain.CostBasis),
+		lastPrices: make(map[string]float64),
+		dayStart:   make(map[string]float64),
+	}
+}
+
+// AddCheck adds a custom check, it runs after the built-in ones
+func (r *RiskManager) AddCheck(check RiskCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check)
+}
+
+func (r *RiskManager) SetLimits(limits RiskLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = limits
+}
+
+// SetPositions resets positions, e.g. after fetching them from the exchange
+func (r *RiskManager) SetPositions(positions []domain.Position) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.positions = make(map[string]*domain.CostBasis)
+	for _, pos := range positions {
+		size := pos.Size
+		if pos.Side != "long" {
+			size = -size
+		}
+		key := symbolKey(pos.Symbol)
+		price := pos.Price
+		if start, ok := r.dayStart[key]; ok {
+			// P&L before the day start is not today's
+			price = start
+		}
+		r.positions[key] = &domain.CostBasis{Size: size, Price: price}
+	}
+}
+
+// Observe updates the last price of the instrument
+func (r *RiskManager) Observe(ticker domain.Ticker) {
+	price := ticker.Last
+	if price == 0 {
+		price = (ticker.Bid + ticker.Ask) / 2
+	}
+	if price == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastPrices[symbolKey(ticker.ProductId)] = price
+}
+
+// OnExecution updates positions and realized P&L
+func (r *RiskManager) OnExecution(symbol string, side domain.Action, amount int64, price float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rollDay(time.Now())
+	key := symbolKey(symbol)
+	pos, ok := r.positions[key]
+	if !ok {
+		pos = &domain.CostBasis{}
+		r.positions[key] = pos
+	}
+	if side == domain.Sell {
+		amount = -amount
+	}
+	r.realizedPnL += pos.Apply(amount, price)
+	if pos.Size == 0 {
+		delete(r.dayStart, key)
+	}
+}
+
+// Evaluate runs all checks. It returns the allowed size and the veto of the
+// first check that reduced the order, nil if the order is allowed as is.
+// Exits of triggered stops are not limited by the order rate and price deviation.
+func (r *RiskManager) Evaluate(order domain.Order, exit bool) (int64, *domain.RiskVeto) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.rollDay(now)
+	ctx := r.context(now)
+	ctx.Exit = exit
+	allowed := int64(order.Quantity)
+	var veto *domain.RiskVeto
+	for _, check := range r.checks {
+		size, reason := check.Check(order, ctx)
+		if size >= allowed {
+			continue
+		}
+		allowed = domain.Max(size, 0)
+		veto = &domain.RiskVeto{
+			Check:       check.Name(),
+			Reason:      reason,
+			Order:       order,
+			AllowedSize: allowed,
+			TS:          now,
+		}
+		if allowed == 0 {
+			break
+		}
+		order.Quantity = float64(allowed)
+	}
+	if allowed > 0 {
+		r.orders = append(r.orders, now)
+	}
+	return allowed, veto
+}
+
+func (r *RiskManager) context(now time.Time) RiskContext {
+	// orders sent during the last minute
+	for len(r.orders) > 0 && now.Sub(r.orders[0]) > time.Minute {
+		r.orders = r.orders[1:]
+	}
+	ctx := RiskContext{
+		Limits:           r.limits,
+		Positions:        make(map[string]int64),
+		LastPrices:       make(map[string]float64),
+		DailyPnL:         r.realizedPnL,
+		OrdersLastMinute: len(r.orders),
+	}
+	for symbol, price := range r.lastPrices {
+		ctx.LastPrices[symbol] = price
+	}
+	for symbol, pos := range r.positions {
+		ctx.Positions[symbol] = pos.Size
+		if price, ok := r.lastPrices[symbol]; ok && pos.Size != 0 {
+			// unrealized P&L since the day start or the position opening
+			ctx.DailyPnL += float64(pos.Size) * (price - pos.Price)
+		}
+	}
+	return ctx
+}
+
+// rollDay resets daily P&L at 00:00 UTC. Cost basis of open positions moves
+// to the last price, so P&L of the previous days is not counted again.
+func (r *RiskManager) rollDay(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day == r.day {
+		return
+	}
+	r.day = day
+	r.realizedPnL = 0
+	r.dayStart = make(map[string]float64)
+	for symbol, pos := range r.positions {
+		if price, ok := r.lastPrices[symbol]; ok && pos.Size != 0 {
+			r.dayStart[symbol] = price
+			pos.Price = price
+		}
+	}
+}
+
+// Built-in checks
+
+type killSwitch struct{}
+
+func (killSwitch) Name() string { return "kill_switch" }
+
+func (killSwitch) Check(order domain.Order, ctx RiskContext) (int64, string) {
+	if ctx.Limits.KillSwitch {
+		return 0, "kill switch is on"
+	}
+	return int64(order.Quantity), ""
+}
+
+type dailyLoss struct{}
+
+func (dailyLoss) Name() string { return "max_daily_loss" }
+
+// Check allows only orders reducing the position after the daily loss limit is hit
+func (dailyLoss) Check(order domain.Order, ctx RiskContext) (int64, string) {
+	size := int64(order.Quantity)
+	if ctx.Limits.MaxDailyLoss <= 0 || ctx.DailyPnL > -ctx.Limits.MaxDailyLoss {
+		return size, ""
+	}
+	pos := signed(order.Side, ctx.Positions[symbolKey(order.Symbol)])
+	reason := fmt.Sprintf("daily loss %.2f exceeds %.2f", -ctx.DailyPnL, ctx.Limits.MaxDailyLoss)
+	if pos >= 0 {
+		return 0, reason
+	}
+	return domain.Min(size, -pos), reason
+}
+
+type orderRate struct{}
+
+func (orderRate) Name() string { return "max_orders_per_minute" }
+
+func (orderRate) Check(order domain.Order, ctx RiskContext) (int64, string) {
+	if exempt(order, ctx) {
+		return int64(order.Quantity), ""
+	}
+	if ctx.Limits.MaxOrdersPerMinute > 0 && ctx.OrdersLastMinute >= ctx.Limits.MaxOrdersPerMinute {
+		return 0, fmt.Sprintf("%d orders sent during the last minute", ctx.OrdersLastMinute)
+	}
+	return int64(order.Quantity), ""
+}
+
+type priceDeviation struct{}
+
+func (priceDeviation) Name() string { return "max_price_deviation" }
+
+func (priceDeviation) Check(order domain.Order, ctx RiskContext) (int64, string) {
+	last, ok := ctx.LastPrices[symbolKey(order.Symbol)]
+	if ctx.Limits.MaxPriceDeviationPercent <= 0 || !ok || order.Type == domain.MktType || exempt(order, ctx) {
+		return int64(order.Quantity), ""
+	}
+	deviation := math.Abs(order.LimitPrice-last) / last * 100
+	if deviation > ctx.Limits.MaxPriceDeviationPercent {
+		return 0, fmt.Sprintf("price %.2f deviates from last %.2f by %.2f%%", order.LimitPrice, last, deviation)
+	}
+	return int64(order.Quantity), ""
+}
+
+type notional struct{}
+
+func (notional) Name() string { return "max_notional" }
+
+// Check limits the sum of absolute positions valued at last prices
+func (notional) Check(order domain.Order, ctx RiskContext) (int64, string) {
+	size := int64(order.Quantity)
+	key := symbolKey(order.Symbol)
+	price, ok := ctx.LastPrices[key]
+	if ctx.Limits.MaxNotional <= 0 || !ok {
+		return size, ""
+	}
+	var others float64
+	for symbol, pos := range ctx.Positions {
+		if symbol != key {
+			others += math.Abs(float64(pos)) * ctx.LastPrices[symbol]
+		}
+	}
+	maxPosition := int64((ctx.Limits.MaxNotional - others) / price)
+	allowed := maxPosition - signed(order.Side, ctx.Positions[key])
+	if allowed >= size {
+		return size, ""
+	}
+	return allowed, fmt.Sprintf("notional exposure is limited to %.2f", ctx.Limits.MaxNotional)
+}
+
+// signed returns the position in the direction of the order side
+// exempt reports whether the order only reduces the position, such orders
+// must not be held back when the market moves fast
+func exempt(order domain.Order, ctx RiskContext) bool {
+	pos := signed(order.Side, ctx.Positions[symbolKey(order.Symbol)])
+	return ctx.Exit || (pos < 0 && int64(order.Quantity) <= -pos)
+}
+
+func signed(side domain.Action, position int64) int64 {
+	if side == domain.Sell {
+		return -position
+	}
+	return position
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"bot/domain"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestRiskManager_Evaluate(t *testing.T) {
+	risk := NewRiskManager(RiskLimits{MaxNotional: 1000, MaxDailyLoss: 50, MaxPriceDeviationPercent: 5})
+	risk.Observe(domain.Ticker{ProductId: "PI_XBTUSD", Last: 100})
+	buy := *domain.NewOrder("pi_xbtusd", domain.Buy, domain.IocType, 101, 15)
+	// notional: at most 10 contracts at 100
+	allowed, veto := risk.Evaluate(buy, false)
+	assert.Equal(t, int64(10), allowed)
+	assert.Equal(t, "max_notional", veto.Check)
+	// price deviation
+	allowed, veto = risk.Evaluate(*domain.NewOrder("pi_xbtusd", domain.Buy, domain.IocType, 110, 1), false)
+	assert.Equal(t, int64(0), allowed)
+	assert.Equal(t, "max_price_deviation", veto.Check)
+	// daily loss: long 10 at 100, price falls to 94
+	risk.OnExecution("PI_XBTUSD", domain.Buy, 10, 100)
+	risk.Observe(domain.Ticker{ProductId: "PI_XBTUSD", Last: 94})
+	allowed, veto = risk.Evaluate(*domain.NewOrder("pi_xbtusd", domain.Buy, domain.IocType, 95, 1), false)
+	assert.Equal(t, int64(0), allowed)
+	assert.Equal(t, "max_daily_loss", veto.Check)
+	// reducing the position is still allowed
+	allowed, veto = risk.Evaluate(*domain.NewOrder("pi_xbtusd", domain.Sell, domain.IocType, 93, 15), false)
+	assert.Equal(t, int64(10), allowed)
+	assert.Equal(t, "max_daily_loss", veto.Check)
+}
+
+func TestBot_ChangePositionKillSwitch(t *testing.T) {
+	exm := ExchangeMock{}
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreVeto", mock.Anything, mock.Anything).Return(nil)
+	var bot = New(&exm, &nm, &sm, &PredictorMock{}, defaultParams)
+	bot.SetKillSwitch(true)
+	decision := domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 7500)
+	err := bot.ChangePosition(context.Background(), *decision)
+	assert.Nil(t, err)
+	exm.AssertNotCalled(t, "SendOrder", mock.Anything)
+	nm.AssertNumberOfCalls(t, "Notify", 1)
+	veto := sm.Calls[0].Arguments.Get(1).(domain.RiskVeto)
+	assert.Equal(t, decision.ID, veto.DecisionID)
+	assert.Equal(t, "kill_switch", veto.Check)
+	assert.True(t, bot.Parameters().Risk.KillSwitch)
+}
+
+func TestRiskManager_DayRoll(t *testing.T) {
+	risk := NewRiskManager(RiskLimits{MaxDailyLoss: 50})
+	risk.Observe(domain.Ticker{ProductId: "PI_XBTUSD", Last: 100})
+	// long 10 at 100 yesterday, the day closes at 90
+	risk.OnExecution("PI_XBTUSD", domain.Buy, 10, 100)
+	risk.Observe(domain.Ticker{ProductId: "PI_XBTUSD", Last: 90})
+	risk.day = "2000-01-01"
+	allowed, veto := risk.Evaluate(*domain.NewOrder("pi_xbtusd", domain.Buy, domain.IocType, 90, 1), false)
+	assert.Equal(t, int64(1), allowed)
+	assert.Nil(t, veto)
+	assert.Equal(t, 90.0, risk.positions["pi_xbtusd"].Price)
+	// closing at 88 loses 20 today, not 120
+	risk.OnExecution("PI_XBTUSD", domain.Sell, 10, 88)
+	assert.Equal(t, -20.0, risk.realizedPnL)
+	_, ok := risk.dayStart["pi_xbtusd"]
+	assert.False(t, ok)
+	// a new position is marked from its own entry price
+	risk.OnExecution("PI_XBTUSD", domain.Buy, 5, 88)
+	risk.Observe(domain.Ticker{ProductId: "PI_XBTUSD", Last: 87})
+	assert.Equal(t, -25.0, risk.context(time.Now()).DailyPnL)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/metrics"
+)
+
+// sequencer keeps the last sequence_length samples of the instrument in a ring
+// buffer and emits the window every sequence_stride samples: disjoint sequences
+// if the stride is the length, a sliding window if it's less. Samples are the
+// tickers or, with sequence_interval, the last ticker of every interval.
+type sequencer struct {
+	length   int
+	stride   int
+	interval time.Duration
+	ring     []domain.Ticker
+	next     int // write position of the ring
+	count    int // samples in the ring
+	since    int // samples since the last emitted window
+	// resampling
+	bucket  time.Time      // start of the interval of the pending ticker
+	pending *domain.Ticker // last ticker of the interval
+}
+
+func newSequencer(params InstrumentParameters) *sequencer {
+	length := domain.Max(int64(params.SequenceLength), 1)
+	stride := params.SequenceStride
+	if stride == 0 {
+		stride = int(length)
+	}
+	return &sequencer{
+		length:   int(length),
+		stride:   stride,
+		interval: params.sequenceInterval(),
+		ring:     make([]domain.Ticker, length),
+	}
+}
+
+func (s *sequencer) push(ticker domain.Ticker) ([]domain.Ticker, bool) {
+	if s.interval == 0 {
+		return s.add(ticker)
+	}
+	at := tickerTime(ticker)
+	if ticker.Time == 0 {
+		// no exchange time, resampled by the arrival time
+		at = time.Now()
+	}
+	bucket := at.Truncate(s.interval)
+	if s.pending == nil || !bucket.After(s.bucket) {
+		s.bucket, s.pending = bucket, &ticker
+		return nil, false
+	}
+	// the interval is over, intervals without tickers repeat its sample
+	out, ok := s.add(*s.pending)
+	for t, n := s.bucket.Add(s.interval), 0; t.Before(bucket) && n < s.length; t, n = t.Add(s.interval), n+1 {
+		if seq, emitted := s.add(*s.pending); emitted {
+			out, ok = seq, emitted
+		}
+	}
+	s.bucket, s.pending = bucket, &ticker
+	return out, ok
+}
+
+// add puts the sample to the ring and returns the window if it's time to emit it
+func (s *sequencer) add(ticker domain.Ticker) ([]domain.Ticker, bool) {
+	s.ring[s.next] = ticker
+	s.next = (s.next + 1) % s.length
+	if s.count < s.length {
+		s.count++
+	}
+	s.since++
+	if s.count < s.length || s.since < s.stride {
+		return nil, false
+	}
+	s.since = 0
+	// oldest first
+	window := make([]domain.Ticker, 0, s.length)
+	window = append(window, s.ring[s.next:]...)
+	window = append(window, s.ring[:s.next]...)
+	return window, true
+}
+
+func (s *sequencer) sameSettings(params InstrumentParameters) bool {
+	stride := params.SequenceStride
+	if stride == 0 {
+		stride = params.SequenceLength
+	}
+	return s.length == params.SequenceLength && s.stride == stride && s.interval == params.sequenceInterval()
+}
+
+// sequenceRouter keeps a separate sequencer per instrument,
+// so sequences of different products are never mixed
+type sequenceRouter map[string]*sequencer
+
+func newSequenceRouter(instruments []InstrumentParameters) sequenceRouter {
+	r := make(sequenceRouter)
+	for _, inst := range instruments {
+		r[symbolKey(inst.Instrument)] = newSequencer(inst)
+	}
+	return r
+}
+
+// push routes the ticker by its product id, tickers of unknown products are dropped
+func (r sequenceRouter) push(ticker domain.Ticker) ([]domain.Ticker, bool) {
+	seq, ok := r[symbolKey(ticker.ProductId)]
+	if !ok {
+		return nil, false
+	}
+	return seq.push(ticker)
+}
+
+// reload returns a router for new instrument settings, sequences of
+// instruments with unchanged sequence settings are kept
+func (r sequenceRouter) reload(instruments []InstrumentParameters) sequenceRouter {
+	next := make(sequenceRouter)
+	for _, inst := range instruments {
+		key := symbolKey(inst.Instrument)
+		if seq, ok := r[key]; ok && seq.sameSettings(inst) {
+			next[key] = seq
+		} else {
+			next[key] = newSequencer(inst)
+		}
+	}
+	return next
+}
+
+// sequenceQueue passes sequences from the collector to the processing without
+// blocking the collector: if the processing is slower than the feed, a waiting
+// sequence is replaced by the newer one of the same instrument
+type sequenceQueue struct {
+	mu      sync.Mutex
+	order   []string // instruments in the order of waiting
+	waiting map[string][]domain.Ticker
+	ready   chan struct{}
+}
+
+func newSequenceQueue() *sequenceQueue {
+	return &sequenceQueue{waiting: make(map[string][]domain.Ticker), ready: make(chan struct{}, 1)}
+}
+
+func (q *sequenceQueue) put(tickers []domain.Ticker) {
+	key := symbolKey(tickers[len(tickers)-1].ProductId)
+	q.mu.Lock()
+	if _, ok := q.waiting[key]; ok {
+		metrics.SequencesDropped.WithLabelValues(key).Inc()
+	} else {
+		q.order = append(q.order, key)
+	}
+	q.waiting[key] = tickers
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the waiting sequences, oldest first
+func (q *sequenceQueue) take() [][]domain.Ticker {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sequences := make([][]domain.Ticker, 0, len(q.order))
+	for _, key := range q.order {
+		sequences = append(sequences, q.waiting[key])
+	}
+	q.order = nil
+	q.waiting = make(map[string][]domain.Ticker)
+	return sequences
+}
+
+// Sequences splits recorded tickers into the sequences the bot decides on
+func Sequences(tickers []domain.Ticker, instruments []InstrumentParameters) [][]domain.Ticker {
+	var sequences [][]domain.Ticker
+	router := newSequenceRouter(instruments)
+	for _, ticker := range tickers {
+		if seq, ok := router.push(ticker); ok {
+			sequences = append(sequences, seq)
+		}
+	}
+	return sequences
+}
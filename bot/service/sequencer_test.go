@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bot/domain"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func seqTicker(second int64, last float64) domain.Ticker {
+	return domain.Ticker{ProductId: "PI_XBTUSD", Time: second * 1000, Last: last}
+}
+
+func lasts(tickers []domain.Ticker) []float64 {
+	values := make([]float64, 0, len(tickers))
+	for _, ticker := range tickers {
+		values = append(values, ticker.Last)
+	}
+	return values
+}
+
+func TestSequencer_Sliding(t *testing.T) {
+	var emitted [][]float64
+	s := newSequencer(InstrumentParameters{SequenceLength: 3, SequenceStride: 2})
+	for i := 1; i <= 7; i++ {
+		if seq, ok := s.push(seqTicker(int64(i), float64(i))); ok {
+			emitted = append(emitted, lasts(seq))
+		}
+	}
+	assert.Equal(t, [][]float64{{1, 2, 3}, {3, 4, 5}, {5, 6, 7}}, emitted)
+
+	// disjoint by default
+	emitted = nil
+	s = newSequencer(InstrumentParameters{SequenceLength: 3})
+	for i := 1; i <= 7; i++ {
+		if seq, ok := s.push(seqTicker(int64(i), float64(i))); ok {
+			emitted = append(emitted, lasts(seq))
+		}
+	}
+	assert.Equal(t, [][]float64{{1, 2, 3}, {4, 5, 6}}, emitted)
+}
+
+func TestSequencer_Resampling(t *testing.T) {
+	s := newSequencer(InstrumentParameters{SequenceLength: 3, SequenceStride: 1, SequenceInterval: "10s"})
+	var emitted [][]float64
+	// the last ticker of every 10s, the empty interval [20, 30) repeats the sample of [10, 20)
+	for _, ticker := range []domain.Ticker{seqTicker(0, 1), seqTicker(5, 2), seqTicker(12, 3), seqTicker(31, 4), seqTicker(45, 5)} {
+		if seq, ok := s.push(ticker); ok {
+			emitted = append(emitted, lasts(seq))
+		}
+	}
+	assert.Equal(t, [][]float64{{2, 3, 3}, {3, 3, 4}}, emitted)
+	_, ok := s.push(seqTicker(48, 6))
+	assert.False(t, ok)
+	seq, ok := s.push(seqTicker(50, 7))
+	assert.True(t, ok)
+	assert.Equal(t, []float64{3, 4, 6}, lasts(seq))
+	assert.Equal(t, 10*time.Second, s.interval)
+}
+
+func TestSequencer_ResamplingWithoutTime(t *testing.T) {
+	s := newSequencer(InstrumentParameters{SequenceLength: 1, SequenceInterval: "1h"})
+	at := time.Now().Add(-2 * time.Hour)
+	_, ok := s.push(domain.Ticker{ProductId: "PI_XBTUSD", Time: at.UnixNano() / int64(time.Millisecond), Last: 1})
+	assert.False(t, ok)
+	// the ticker without time is in the interval of its arrival, not of 1970
+	seq, ok := s.push(domain.Ticker{ProductId: "PI_XBTUSD", Last: 2})
+	assert.True(t, ok)
+	assert.Equal(t, []float64{1}, lasts(seq))
+	assert.Equal(t, 2.0, s.pending.Last)
+}
+
+func TestSequenceQueue(t *testing.T) {
+	q := newSequenceQueue()
+	xbt := []domain.Ticker{{ProductId: "PI_XBTUSD", Last: 1}}
+	eth := []domain.Ticker{{ProductId: "PI_ETHUSD", Last: 2}}
+	newer := []domain.Ticker{{ProductId: "PI_XBTUSD", Last: 3}}
+	q.put(xbt)
+	q.put(eth)
+	q.put(newer) // the processing is late, the waiting xbt sequence is stale
+	<-q.ready
+	assert.Equal(t, [][]domain.Ticker{newer, eth}, q.take())
+	assert.Empty(t, q.take())
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	// not-std
+	"bot/domain"
+	"bot/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+type State string
+
+// Bot lifecycle states
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateStopping State = "stopping"
+	StateFailed   State = "failed"
+)
+
+var ErrInvalidState = errors.New("invalid bot state")
+
+// Status describes the bot at the moment
+type Status struct {
+	State          State              `json:"state"`
+	Uptime         string             `json:"uptime,omitempty"`
+	LastTickerTime *time.Time         `json:"last_ticker_time,omitempty"`
+	Predictions    map[string]float64 `json:"last_predictions"`      // last predicted value per instrument
+	Models         map[string]string  `json:"last_models,omitempty"` // model of the last prediction per instrument, if reported
+	Positions      map[string]int64   `json:"positions"`
+	LastError      string             `json:"last_error,omitempty"`
+	Connection     string             `json:"connection,omitempty"` // state of the ticker feed connection
+}
+
+// transition changes the state if the current one is one of from
+func (b *Bot) transition(to State, from ...State) error {
+	b.muState.Lock()
+	defer b.muState.Unlock()
+	for _, state := range from {
+		if b.state == state {
+			b.state = to
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: can't change %s to %s", ErrInvalidState, b.state, to)
+}
+
+func (b *Bot) Status() Status {
+	b.muState.Lock()
+	status := Status{
+		State:       b.state,
+		Predictions: make(map[string]float64),
+	}
+	if b.state == StateRunning {
+		status.Uptime = time.Since(b.startedAt).Round(time.Second).String()
+	}
+	if !b.lastTicker.IsZero() {
+		lastTicker := b.lastTicker
+		status.LastTickerTime = &lastTicker
+	}
+	for instrument, value := range b.predictions {
+		status.Predictions[instrument] = value
+	}
+	for instrument, source := range b.sources {
+		if status.Models == nil {
+			status.Models = make(map[string]string)
+		}
+		status.Models[instrument] = source
+	}
+	if b.lastError != nil {
+		status.LastError = b.lastError.Error()
+	}
+	status.Connection = b.connection
+	b.muState.Unlock()
+
+	b.muPositions.Lock()
+	defer b.muPositions.Unlock()
+	status.Positions = make(map[string]int64)
+	for symbol, size := range b.openPositions {
+		status.Positions[symbol] = size
+	}
+	return status
+}
+
+// WatchConnection tracks connection events of the exchange feeds: the state is shown
+// in Status and a lost connection is notified
+func (b *Bot) WatchConnection(events <-chan domain.ConnectionEvent) {
+	go func() {
+		for event := range events {
+			connected := 0.0
+			if event.State == domain.Connected {
+				connected = 1
+			}
+			metrics.WebSocketConnected.WithLabelValues(event.Feeds).Set(connected)
+			log.Infof("%s feed: %s %s", event.Feeds, event.State, event.Error)
+			if event.Feeds == domain.TickerFeed {
+				b.muState.Lock()
+				b.connection = event.State
+				b.muState.Unlock()
+			}
+			if event.State == domain.Disconnected {
+				if err := b.notifier.Notify(fmt.Sprintf("%s feed disconnected: %s", event.Feeds, event.Error)); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}()
+}
+
+// setQuote records the last ticker of the instrument
+func (b *Bot) setQuote(ticker domain.Ticker) {
+	b.muState.Lock()
+	defer b.muState.Unlock()
+	b.lastTicker = tickerTime(ticker)
+	b.quotes[symbolKey(ticker.ProductId)] = ticker
+}
+
+func (b *Bot) quote(symbol string) (domain.Ticker, bool) {
+	b.muState.Lock()
+	defer b.muState.Unlock()
+	ticker, ok := b.quotes[symbolKey(symbol)]
+	return ticker, ok
+}
+
+func tickerTime(ticker domain.Ticker) time.Time {
+	return time.Unix(0, ticker.Time*int64(time.Millisecond))
+}
+
+func (b *Bot) setPrediction(instrument string, value float64, source string) {
+	b.muState.Lock()
+	defer b.muState.Unlock()
+	b.predictions[symbolKey(instrument)] = value
+	if source != "" {
+		b.sources[symbolKey(instrument)] = source
+	} else {
+		delete(b.sources, symbolKey(instrument))
+	}
+}
+
+func (b *Bot) setLastError(err error) {
+	b.muState.Lock()
+	defer b.muState.Unlock()
+	b.lastError = err
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	// not-std
+	"bot/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// stopRetry is how long a triggered exit waits for the position to change
+// before it is triggered again, e.g. if the IOC order was not executed
+const stopRetry = 10 * time.Second
+
+// positionStop is the entry of an open position for the exit triggers
+type positionStop struct {
+	entry       domain.CostBasis
+	best        float64   // best price since entry for the trailing stop
+	triggeredAt time.Time // time of the quote the exit was triggered at
+}
+
+// trackEntry updates the entry price with an execution of signed size delta,
+// must be called with muPositions locked
+func (b *Bot) trackEntry(symbol string, delta int64, price float64) {
+	key := symbolKey(symbol)
+	s, ok := b.stops[key]
+	if !ok {
+		s = &positionStop{}
+		b.stops[key] = s
+	}
+	before := s.entry.Size
+	s.entry.Apply(delta, price)
+	switch {
+	case s.entry.Size == 0:
+		delete(b.stops, key)
+	case before == 0 || (before > 0) != (s.entry.Size > 0):
+		// opened or flipped
+		s.best = price
+	}
+	s.triggeredAt = time.Time{}
+}
+
+// setEntries sets entries of the positions fetched from the exchange,
+// must be called with muPositions locked
+func (b *Bot) setEntries(positions []domain.Position) {
+	b.stops = make(map[string]*positionStop)
+	for _, pos := range positions {
+		size := pos.Size
+		if pos.Side != "long" {
+			size = -size
+		}
+		if size != 0 {
+			b.stops[symbolKey(pos.Symbol)] = &positionStop{entry: domain.CostBasis{Size: size, Price: pos.Price}, best: pos.Price}
+		}
+	}
+}
+
+// checkStops marks the open position of the ticker instrument to the bid (long)
+// or the ask (short) and returns the exit decision if a stop-loss, take-profit
+// or trailing stop is crossed
+func (b *Bot) checkStops(ticker domain.Ticker) (domain.Decision, bool) {
+	params, _, ok := b.instrument(ticker.ProductId)
+	if !ok || (params.StopLossPercent == 0 && params.TakeProfitPercent == 0 && params.TrailingStopPercent == 0) {
+		return domain.Decision{}, false
+	}
+	key := symbolKey(ticker.ProductId)
+	now := tickerTime(ticker)
+	b.muPositions.Lock()
+	defer b.muPositions.Unlock()
+	s, ok := b.stops[key]
+	position := b.openPositions[key]
+	if !ok || position == 0 || s.entry.Price <= 0 {
+		return domain.Decision{}, false
+	}
+	long := position > 0
+	side, mark, action := "long", ticker.Bid, domain.Sell
+	if !long {
+		side, mark, action = "short", ticker.Ask, domain.Buy
+	}
+	if mark <= 0 {
+		return domain.Decision{}, false
+	}
+	if (long && mark > s.best) || (!long && mark < s.best) {
+		s.best = mark
+	}
+	if !s.triggeredAt.IsZero() && now.Sub(s.triggeredAt) < stopRetry {
+		return domain.Decision{}, false
+	}
+	// change of the price in favor of the position, %
+	change := (mark - s.entry.Price) / s.entry.Price * 100
+	drawdown := (s.best - mark) / s.best * 100
+	if !long {
+		change, drawdown = -change, -drawdown
+	}
+	var trigger string
+	switch {
+	case params.StopLossPercent > 0 && change <= -params.StopLossPercent:
+		trigger = domain.StopLossTrigger
+	case params.TrailingStopPercent > 0 && drawdown >= params.TrailingStopPercent:
+		trigger = domain.TrailingStopTrigger
+	case params.TakeProfitPercent > 0 && change >= params.TakeProfitPercent:
+		trigger = domain.TakeProfitTrigger
+	default:
+		return domain.Decision{}, false
+	}
+	s.triggeredAt = now
+	// exits are IOC orders whatever the execution style is
+	params.Execution = ExecutionIOC
+	size := domain.Max(position, -position)
+	decision := domain.NewDecision(params.Instrument, action, size, b.limitPrice(params, action, size, ticker))
+	decision.Trigger = trigger
+	message := fmt.Sprintf("*%s triggered*: %s position %d *%s*, entry %.2f, price %.2f",
+		trigger, side, decision.Size, key, s.entry.Price, mark)
+	log.Warning(message)
+	if err := b.notifier.Notify(message); err != nil {
+		log.Error(err)
+	}
+	return *decision, true
+}
+
+// executeStop sends the IOC exit order of a triggered stop
+func (b *Bot) executeStop(ctx context.Context, decision domain.Decision) error {
+	if err := b.changePosition(ctx, decision, domain.IocType); err != nil {
+		return fmt.Errorf("%s exit failed: %w", decision.Trigger, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bot/domain"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func executedResponse(side domain.Action, amount int64, price float64) *domain.SendOrderResponse {
+	resp := &domain.SendOrderResponse{BaseResponse: domain.BaseResponse{Result: domain.Success}}
+	resp.SendStatus = domain.Status{Status: "placed", OrderEvents: []domain.OrderEvent{{
+		Type:      domain.ExecutionEvent,
+		Price:     price,
+		Amount:    amount,
+		ExecOrder: &domain.Order{Symbol: "PI_XBTUSD", Side: side},
+	}}}
+	return resp
+}
+
+func stopTicker(at time.Time, bid float64) domain.Ticker {
+	return domain.Ticker{ProductId: "PI_XBTUSD", Time: at.UnixNano() / int64(time.Millisecond), Bid: bid, Ask: bid + 1}
+}
+
+func TestBot_StopLoss(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("SendOrder", mock.MatchedBy(func(order domain.Order) bool { return order.Side == domain.Buy })).
+		Return(executedResponse(domain.Buy, 2, 100), nil)
+	exm.On("SendOrder", mock.MatchedBy(func(order domain.Order) bool { return order.Side == domain.Sell })).
+		Return(executedResponse(domain.Sell, 2, 94), nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	params := defaultParams
+	params.StopLossPercent = 5
+	bot := New(&exm, &nm, &sm, &PredictorMock{}, params)
+
+	err := bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 101))
+	assert.Nil(t, err)
+	start := time.Unix(1612270825, 0)
+	_, ok := bot.checkStops(stopTicker(start, 96))
+	assert.False(t, ok)
+
+	decision, ok := bot.checkStops(stopTicker(start.Add(time.Second), 94))
+	assert.True(t, ok)
+	assert.Equal(t, domain.StopLossTrigger, decision.Trigger)
+	assert.Equal(t, domain.Sell, decision.Action)
+	assert.Equal(t, int64(2), decision.Size)
+	// not triggered again while the exit is in progress
+	_, ok = bot.checkStops(stopTicker(start.Add(2*time.Second), 93))
+	assert.False(t, ok)
+
+	assert.Nil(t, bot.executeStop(context.Background(), decision))
+	exit := exm.Calls[len(exm.Calls)-1].Arguments.Get(0).(domain.Order)
+	assert.Equal(t, domain.IocType, exit.Type)
+	assert.Empty(t, bot.Status().Positions)
+	assert.Empty(t, bot.stops)
+	sm.AssertCalled(t, "StoreEvent", mock.Anything, mock.MatchedBy(func(record domain.EventRecord) bool {
+		return record.Trigger == domain.StopLossTrigger
+	}))
+}
+
+func TestBot_TrailingStop(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("SendOrder", mock.Anything).Return(executedResponse(domain.Sell, 2, 100), nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	params := defaultParams
+	params.TrailingStopPercent = 5
+	params.TakeProfitPercent = 50
+	bot := New(&exm, &nm, &sm, &PredictorMock{}, params)
+
+	// short from 100
+	err := bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Sell, 2, 99))
+	assert.Nil(t, err)
+	start := time.Unix(1612270825, 0)
+	// the ask falls to 80, then rises by less than 5%
+	_, ok := bot.checkStops(stopTicker(start, 79))
+	assert.False(t, ok)
+	_, ok = bot.checkStops(stopTicker(start.Add(time.Second), 82))
+	assert.False(t, ok)
+
+	decision, ok := bot.checkStops(stopTicker(start.Add(2*time.Second), 84))
+	assert.True(t, ok)
+	assert.Equal(t, domain.TrailingStopTrigger, decision.Trigger)
+	assert.Equal(t, domain.Buy, decision.Action)
+	assert.Equal(t, int64(2), decision.Size)
+}
+
+func TestBot_StopExitAfterRateLimit(t *testing.T) {
+	exm := ExchangeMock{}
+	exm.On("SendOrder", mock.MatchedBy(func(order domain.Order) bool { return order.Side == domain.Buy })).
+		Return(executedResponse(domain.Buy, 2, 100), nil)
+	exm.On("SendOrder", mock.MatchedBy(func(order domain.Order) bool { return order.Side == domain.Sell })).
+		Return(executedResponse(domain.Sell, 2, 94), nil)
+	nm := NotifierMock{}
+	nm.On("Notify", mock.Anything).Return(nil)
+	sm := StorageMock{}
+	sm.On("StoreEvent", mock.Anything, mock.Anything).Return(nil)
+	sm.On("StoreVeto", mock.Anything, mock.Anything).Return(nil)
+	params := defaultParams
+	params.StopLossPercent = 5
+	params.Risk.MaxOrdersPerMinute = 1
+	bot := New(&exm, &nm, &sm, &PredictorMock{}, params)
+
+	assert.Nil(t, bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 2, 101)))
+	// the limit is used up, a new entry is vetoed
+	assert.Nil(t, bot.ChangePosition(context.Background(), *domain.NewDecision("PI_XBTUSD", domain.Buy, 1, 101)))
+	exm.AssertNumberOfCalls(t, "SendOrder", 1)
+	sm.AssertNumberOfCalls(t, "StoreVeto", 1)
+
+	decision, ok := bot.checkStops(stopTicker(time.Unix(1612270825, 0), 94))
+	assert.True(t, ok)
+	assert.Nil(t, bot.executeStop(context.Background(), decision))
+	exm.AssertNumberOfCalls(t, "SendOrder", 2)
+	sm.AssertNumberOfCalls(t, "StoreVeto", 1)
+	assert.Empty(t, bot.Status().Positions)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"math"
+	// not-std
+	"bot/domain"
+)
+
+// DefaultEntryZ is the z-score of the mid price the mean reversion enters at
+const DefaultEntryZ = 2.0
+
+// StrategyInput is the data a strategy decides on
+type StrategyInput struct {
+	Tickers  []domain.Ticker // sequence of the instrument, oldest first
+	Position int64           // signed position including resting orders
+	Params   InstrumentParameters
+}
+
+// Signal is the action chosen by a strategy
+type Signal struct {
+	Action    domain.Action
+	Size      int64   // order_size if 0
+	Value     float64 // shown in /status, the prediction for the model strategy
+	Threshold float64 // the value is compared with, stored in the prediction audit log
+	Source    string  // model that produced the prediction, if reported by the Predictor
+}
+
+// Strategy decides the action on a ticker sequence of the instrument.
+// Calls are canceled when the bot is stopped and are limited by Timeouts.Predict.
+type Strategy interface {
+	Decide(ctx context.Context, input StrategyInput) (Signal, error)
+}
+
+// TargetSignal returns the signal changing position to target
+func TargetSignal(position int64, target int64, value float64) Signal {
+	switch {
+	case target > position:
+		return Signal{Action: domain.Buy, Size: target - position, Value: value}
+	case target < position:
+		return Signal{Action: domain.Sell, Size: position - target, Value: value}
+	}
+	return Signal{Action: domain.None, Value: value}
+}
+
+// ModelStrategy buys if the prediction is above decision_threshold
+// and sells if it's below 1 - decision_threshold
+type ModelStrategy struct {
+	Model Predictor
+}
+
+func (s ModelStrategy) Decide(ctx context.Context, input StrategyInput) (Signal, error) {
+	// receive predicted value in range (0,1)
+	var value float64
+	var source string
+	var err error
+	if model, ok := s.Model.(SourcePredictor); ok {
+		value, source, err = model.PredictWithSource(ctx, input.Tickers...)
+	} else {
+		value, err = s.Model.Predict(ctx, input.Tickers...)
+	}
+	if err != nil {
+		return Signal{Action: domain.None}, err
+	}
+	threshold := input.Params.DecisionThreshold
+	signal := Signal{Action: domain.None, Value: value, Threshold: threshold, Source: source}
+	switch {
+	case value > threshold:
+		signal.Action = domain.Buy
+	case value < 1-threshold:
+		signal.Action = domain.Sell
+	}
+	return signal, nil
+}
+
+// MACrossover is long order_size while the fast moving average of the mid
+// price is above the slow one and short while it's below
+type MACrossover struct {
+	FastPeriod int
+	SlowPeriod int
+}
+
+func (s MACrossover) Decide(ctx context.Context, input StrategyInput) (Signal, error) {
+	prices := midPrices(input.Tickers)
+	if len(prices) < s.SlowPeriod {
+		return Signal{Action: domain.None}, nil
+	}
+	fast := mean(prices[len(prices)-s.FastPeriod:])
+	slow := mean(prices[len(prices)-s.SlowPeriod:])
+	value := fast/slow - 1
+	switch {
+	case fast > slow:
+		return TargetSignal(input.Position, input.Params.OrderSize, value), nil
+	case fast < slow:
+		return TargetSignal(input.Position, -input.Params.OrderSize, value), nil
+	}
+	return Signal{Action: domain.None, Value: value}, nil
+}
+
+// MeanReversion goes short order_size when the mid price is EntryZ standard
+// deviations above the mean of the window, long when it's below, and closes
+// the position when the price returns to the mean. No orders are sent while the
+// bid/ask spread is wider than MaxSpreadPercent of the mid price.
+type MeanReversion struct {
+	Window           int // the whole sequence if 0
+	EntryZ           float64
+	MaxSpreadPercent float64 // no limit if 0
+}
+
+func (s MeanReversion) Decide(ctx context.Context, input StrategyInput) (Signal, error) {
+	prices := midPrices(input.Tickers)
+	if s.Window > 0 && len(prices) > s.Window {
+		prices = prices[len(prices)-s.Window:]
+	}
+	if len(prices) < 2 {
+		return Signal{Action: domain.None}, nil
+	}
+	last := input.Tickers[len(input.Tickers)-1]
+	mid := prices[len(prices)-1]
+	if s.MaxSpreadPercent > 0 && (last.Ask-last.Bid)/mid*100 > s.MaxSpreadPercent {
+		return Signal{Action: domain.None}, nil
+	}
+	avg := mean(prices)
+	var variance float64
+	for _, price := range prices {
+		variance += (price - avg) * (price - avg)
+	}
+	std := math.Sqrt(variance / float64(len(prices)))
+	if std == 0 {
+		return Signal{Action: domain.None}, nil
+	}
+	z := (mid - avg) / std
+	entry := s.EntryZ
+	if entry == 0 {
+		entry = DefaultEntryZ
+	}
+	var signal Signal
+	switch {
+	case z >= entry:
+		signal = TargetSignal(input.Position, -input.Params.OrderSize, z)
+	case z <= -entry:
+		signal = TargetSignal(input.Position, input.Params.OrderSize, z)
+	case (input.Position > 0 && z >= 0) || (input.Position < 0 && z <= 0):
+		// back to the mean
+		signal = TargetSignal(input.Position, 0, z)
+	default:
+		signal = Signal{Action: domain.None, Value: z}
+	}
+	signal.Threshold = entry
+	return signal, nil
+}
+
+// newStrategy returns the strategy of the instrument settings
+func newStrategy(params InstrumentParameters, model Predictor) Strategy {
+	c := params.Strategy
+	switch c.Name {
+	case StrategyMACrossover:
+		return MACrossover{FastPeriod: c.FastPeriod, SlowPeriod: c.SlowPeriod}
+	case StrategyMeanReversion:
+		return MeanReversion{Window: c.Window, EntryZ: c.EntryZ, MaxSpreadPercent: c.MaxSpreadPercent}
+	}
+	return ModelStrategy{Model: model}
+}
+
+// midPrices returns (bid + ask) / 2 of the tickers, the last price if a side is missing
+func midPrices(tickers []domain.Ticker) []float64 {
+	prices := make([]float64, 0, len(tickers))
+	for _, ticker := range tickers {
+		if ticker.Bid > 0 && ticker.Ask > 0 {
+			prices = append(prices, (ticker.Bid+ticker.Ask)/2)
+		} else {
+			prices = append(prices, ticker.Last)
+		}
+	}
+	return prices
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bot/domain"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func midTickers(prices ...float64) []domain.Ticker {
+	tickers := make([]domain.Ticker, 0, len(prices))
+	for _, price := range prices {
+		tickers = append(tickers, domain.Ticker{ProductId: "PI_XBTUSD", Bid: price - 0.5, Ask: price + 0.5})
+	}
+	return tickers
+}
+
+func TestMACrossover(t *testing.T) {
+	strategy := MACrossover{FastPeriod: 2, SlowPeriod: 4}
+	params := defaultParams.InstrumentParameters
+	up := midTickers(100, 100, 101, 102)
+	signal, err := strategy.Decide(context.Background(), StrategyInput{Tickers: up, Position: -2, Params: params})
+	assert.Nil(t, err)
+	// from short to long order_size
+	assert.Equal(t, domain.Buy, signal.Action)
+	assert.Equal(t, int64(4), signal.Size)
+
+	signal, _ = strategy.Decide(context.Background(), StrategyInput{Tickers: up, Position: 2, Params: params})
+	assert.Equal(t, domain.None, signal.Action)
+}
+
+func TestMeanReversion(t *testing.T) {
+	strategy := MeanReversion{EntryZ: 1.5}
+	params := defaultParams.InstrumentParameters
+	signal, _ := strategy.Decide(context.Background(), StrategyInput{Tickers: midTickers(100, 100, 100, 100, 110), Params: params})
+	assert.Equal(t, domain.Sell, signal.Action)
+	assert.Equal(t, int64(2), signal.Size)
+	// back to the mean closes the position
+	signal, _ = strategy.Decide(context.Background(), StrategyInput{Tickers: midTickers(100, 110, 90, 100), Position: -2, Params: params})
+	assert.Equal(t, domain.Buy, signal.Action)
+	assert.Equal(t, int64(2), signal.Size)
+	// too wide spread
+	strategy.MaxSpreadPercent = 0.1
+	wide := midTickers(100, 100, 100, 100, 110)
+	wide[4].Ask = 111
+	signal, _ = strategy.Decide(context.Background(), StrategyInput{Tickers: wide, Params: params})
+	assert.Equal(t, domain.None, signal.Action)
+}
+
+func TestParameters_ValidateStrategy(t *testing.T) {
+	params := defaultParams
+	params.Strategy = StrategyConfig{Name: StrategyMACrossover, FastPeriod: 5, SlowPeriod: 20}
+	assert.ErrorIs(t, params.Validate(), ErrInvalidParameters) // longer than sequence_length
+	params.Strategy.SlowPeriod = 10
+	params.DecisionThreshold = 0 // not used
+	assert.Nil(t, params.Validate())
+}
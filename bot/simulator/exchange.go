@@ -0,0 +1,350 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	// not-std
+	"bot/domain"
+)
+
+// Order statuses returned by the simulator, same as Kraken Futures
+const (
+	StatusPlaced             = "placed"
+	StatusIocWouldNotExecute = "iocWouldNotExecute"
+	StatusMarketSuspended    = "marketSuspended"
+	StatusInvalidSize        = "invalidSize"
+	StatusPostWouldExecute   = "postWouldExecute"
+	StatusCancelled          = "cancelled"
+	StatusNotFound           = "notFound"
+	StatusNoOrdersToCancel   = "noOrdersToCancel"
+)
+
+var ErrNoQuote = errors.New("no quote for the instrument")
+
+// Fill is a single execution made by the simulator
+type Fill struct {
+	Symbol  string
+	Side    domain.Action
+	Price   float64
+	Amount  int64
+	TS      time.Time
+	OrderID string
+}
+
+// Exchange is an in-memory matching engine that fills orders against the
+// last known bid/ask of each instrument and answers with Kraken-like responses.
+// Limit and post-only orders rest until a later quote crosses their price.
+// Symbols are case-insensitive and reported in lower case, as Kraken does.
+type Exchange struct {
+	mu          sync.Mutex
+	quotes      map[string]domain.Ticker
+	positions   map[string]*domain.CostBasis
+	fills       []Fill
+	resting     []*domain.Order // in placement order, Quantity is the remainder
+	onFill      func(fills []domain.Fill)
+	realizedPnL float64
+	subscriber  *subscription
+	muPublish   sync.Mutex // held while sending to the subscriber, not e.mu: the consumer may call the exchange
+}
+
+// subscription is closed by Unsubscribe, done wakes a blocked Publish before its channel is closed
+type subscription struct {
+	tickers chan domain.Ticker
+	done    chan struct{}
+}
+
+func New() *Exchange {
+	return &Exchange{
+		quotes:    make(map[string]domain.Ticker),
+		positions: make(map[string]*domain.CostBasis),
+	}
+}
+
+// SetFillHandler sets a function called with fills of resting orders,
+// like the fills feed of Kraken
+func (e *Exchange) SetFillHandler(onFill func(fills []domain.Fill)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onFill = onFill
+}
+
+// SetQuote updates the market state used for matching and fills resting orders
+// crossed by the quote
+func (e *Exchange) SetQuote(ticker domain.Ticker) {
+	e.mu.Lock()
+	symbol := strings.ToLower(ticker.ProductId)
+	e.quotes[symbol] = ticker
+	fills := e.matchResting(symbol, ticker)
+	onFill := e.onFill
+	e.mu.Unlock()
+	if len(fills) > 0 && onFill != nil {
+		onFill(fills)
+	}
+}
+
+// matchResting fills resting orders at their limit price, limited by the quote size
+func (e *Exchange) matchResting(symbol string, ticker domain.Ticker) []domain.Fill {
+	var fills []domain.Fill
+	ts := time.Now()
+	if ticker.Time > 0 {
+		ts = time.Unix(0, ticker.Time*int64(time.Millisecond))
+	}
+	resting := e.resting[:0]
+	for _, order := range e.resting {
+		available, sign := ticker.AskSize, int64(1)
+		crossed := ticker.Ask > 0 && ticker.Ask <= order.LimitPrice
+		if order.Side == domain.Sell {
+			available, sign = ticker.BidSize, -1
+			crossed = ticker.Bid > 0 && ticker.Bid >= order.LimitPrice
+		}
+		var amount int64
+		if order.Symbol == symbol && crossed {
+			amount = int64(order.Quantity)
+			if available > 0 && float64(amount) > available {
+				// a size below one contract fills nothing
+				amount = int64(available)
+			}
+		}
+		if amount > 0 {
+			order.Quantity -= float64(amount)
+			e.fill(Fill{symbol, order.Side, order.LimitPrice, amount, ts, order.OrderID}, sign)
+			fills = append(fills, domain.Fill{
+				Instrument: symbol,
+				Time:       ts.UnixNano() / int64(time.Millisecond),
+				Price:      order.LimitPrice,
+				Buy:        sign > 0,
+				Qty:        float64(amount),
+				OrderID:    order.OrderID,
+				FillID:     domain.NewID(),
+				FillType:   "maker",
+			})
+		}
+		if order.Quantity > 0 {
+			resting = append(resting, order)
+		}
+	}
+	e.resting = resting
+	return fills
+}
+
+// Publish updates the market state and forwards the ticker to the subscriber,
+// the ticker is dropped if the subscription is closed meanwhile
+func (e *Exchange) Publish(ticker domain.Ticker) {
+	e.SetQuote(ticker)
+	e.muPublish.Lock()
+	defer e.muPublish.Unlock()
+	e.mu.Lock()
+	sub := e.subscriber
+	e.mu.Unlock()
+	if sub == nil {
+		return
+	}
+	select {
+	case sub.tickers <- ticker:
+	case <-sub.done:
+	}
+}
+
+// Subscribe returns the ticker channel, it closes the previous subscription
+func (e *Exchange) Subscribe(instruments ...string) (<-chan domain.Ticker, error) {
+	sub := &subscription{make(chan domain.Ticker), make(chan struct{})}
+	e.mu.Lock()
+	previous := e.subscriber
+	e.subscriber = sub
+	e.mu.Unlock()
+	e.close(previous)
+	return sub.tickers, nil
+}
+
+func (e *Exchange) Unsubscribe() error {
+	e.mu.Lock()
+	sub := e.subscriber
+	e.subscriber = nil
+	e.mu.Unlock()
+	e.close(sub)
+	return nil
+}
+
+// close wakes a blocked Publish and closes the channel when no send is in flight
+func (e *Exchange) close(sub *subscription) {
+	if sub == nil {
+		return
+	}
+	close(sub.done)
+	e.muPublish.Lock()
+	defer e.muPublish.Unlock()
+	close(sub.tickers)
+}
+
+func (e *Exchange) GetPositions(ctx context.Context) (*domain.OpenPositionsResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &domain.OpenPositionsResponse{
+		BaseResponse: domain.BaseResponse{Result: domain.Success},
+	}
+	for symbol, pos := range e.positions {
+		resp.OpenPositions = append(resp.OpenPositions, pos.Position(symbol))
+	}
+	return resp, nil
+}
+
+// CancelOrder cancels a resting order
+func (e *Exchange) CancelOrder(ctx context.Context, orderID string) (*domain.CancelOrdersResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &domain.CancelOrdersResponse{
+		BaseResponse: domain.BaseResponse{Result: domain.Success},
+		CancelStatus: domain.Status{OrderID: orderID, Status: StatusNotFound},
+	}
+	for i, order := range e.resting {
+		if order.OrderID == orderID {
+			e.resting = append(e.resting[:i], e.resting[i+1:]...)
+			resp.CancelStatus.Status = StatusCancelled
+			resp.CancelStatus.OrderEvents = []domain.OrderEvent{{Type: domain.CancelEvent, Order: order}}
+			break
+		}
+	}
+	return resp, nil
+}
+
+// CancelOrders cancels all resting orders
+func (e *Exchange) CancelOrders(ctx context.Context) (*domain.CancelOrdersResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &domain.CancelOrdersResponse{
+		BaseResponse: domain.BaseResponse{Result: domain.Success},
+		CancelStatus: domain.Status{Status: StatusNoOrdersToCancel},
+	}
+	for _, order := range e.resting {
+		resp.CancelStatus.Status = StatusCancelled
+		resp.CancelStatus.OrderEvents = append(resp.CancelStatus.OrderEvents,
+			domain.OrderEvent{Type: domain.CancelEvent, Order: order})
+	}
+	e.resting = nil
+	return resp, nil
+}
+
+// SendOrder matches the order against the current bid/ask. Limit, post-only and
+// IOC orders are filled only if the limit price crosses the spread, a crossing
+// post-only order is rejected. The unfilled remainder of IOC and market orders
+// is canceled, of limit and post-only orders it rests on the book.
+func (e *Exchange) SendOrder(ctx context.Context, order domain.Order) (*domain.SendOrderResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	order.Symbol = strings.ToLower(order.Symbol)
+	ticker, ok := e.quotes[order.Symbol]
+	if !ok {
+		return nil, ErrNoQuote
+	}
+	resp := &domain.SendOrderResponse{
+		BaseResponse: domain.BaseResponse{Result: domain.Success},
+	}
+	quantity := int64(order.Quantity)
+	if quantity <= 0 {
+		resp.SendStatus.Status = StatusInvalidSize
+		return resp, nil
+	}
+	price, available, sign := ticker.Ask, ticker.AskSize, int64(1)
+	if order.Side == domain.Sell {
+		price, available, sign = ticker.Bid, ticker.BidSize, -1
+	}
+	if price == 0 {
+		resp.SendStatus.Status = StatusMarketSuspended
+		return resp, nil
+	}
+	crosses := order.Type == domain.MktType ||
+		(sign > 0 && order.LimitPrice >= price) ||
+		(sign < 0 && order.LimitPrice <= price)
+	switch {
+	case order.Type == domain.PostType && crosses:
+		resp.SendStatus.Status = StatusPostWouldExecute
+		return resp, nil
+	case order.Type == domain.IocType && !crosses:
+		resp.SendStatus.Status = StatusIocWouldNotExecute
+		return resp, nil
+	}
+	resp.SendStatus.Status = StatusPlaced
+	execOrder := order
+	execOrder.OrderID = domain.NewID()
+	execOrder.TS = time.Now()
+	resp.SendStatus.OrderID = execOrder.OrderID
+	var amount int64
+	if crosses {
+		amount = quantity
+		if available > 0 && float64(amount) > available {
+			amount = int64(available)
+		}
+	}
+	if amount > 0 {
+		resp.SendStatus.OrderEvents = append(resp.SendStatus.OrderEvents, domain.OrderEvent{
+			Type:        domain.ExecutionEvent,
+			ExecutionID: domain.NewID(),
+			Price:       price,
+			Amount:      amount,
+			ExecOrder:   &execOrder,
+		})
+		e.fill(Fill{order.Symbol, order.Side, price, amount, execOrder.TS, execOrder.OrderID}, sign)
+	}
+	if amount < quantity {
+		remainder := execOrder
+		remainder.Quantity = float64(quantity - amount)
+		event := domain.OrderEvent{Type: domain.CancelEvent, Order: &remainder}
+		if order.Type == domain.LmtType || order.Type == domain.PostType {
+			event.Type = domain.PlaceEvent
+			resting := remainder
+			e.resting = append(e.resting, &resting)
+		}
+		resp.SendStatus.OrderEvents = append(resp.SendStatus.OrderEvents, event)
+	}
+	return resp, nil
+}
+
+func (e *Exchange) fill(f Fill, sign int64) {
+	e.fills = append(e.fills, f)
+	pos, ok := e.positions[f.Symbol]
+	if !ok {
+		pos = &domain.CostBasis{}
+		e.positions[f.Symbol] = pos
+	}
+	e.realizedPnL += pos.Apply(sign*f.Amount, f.Price)
+	if pos.Size == 0 {
+		delete(e.positions, f.Symbol)
+	}
+}
+
+// Fills returns all executions made so far
+func (e *Exchange) Fills() []Fill {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Fill(nil), e.fills...)
+}
+
+// PnL returns realized P&L and unrealized P&L of open positions marked at
+// the price they could be closed at (bid for longs, ask for shorts)
+func (e *Exchange) PnL() (realized float64, unrealized float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for symbol, pos := range e.positions {
+		ticker := e.quotes[symbol]
+		mark := ticker.Bid
+		if pos.Size < 0 {
+			mark = ticker.Ask
+		}
+		unrealized += float64(pos.Size) * (mark - pos.Price)
+	}
+	return e.realizedPnL, unrealized
+}
+
+// Exposure returns the sum of absolute open position sizes
+func (e *Exchange) Exposure() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var exposure int64
+	for _, pos := range e.positions {
+		exposure += domain.Max(pos.Size, -pos.Size)
+	}
+	return exposure
+}
@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"sync"
+	// not-std
+	"bot/domain"
+)
+
+// Feed is a source of live tickers
+type Feed interface {
+	Subscribe(instruments ...string) (<-chan domain.Ticker, error)
+	Unsubscribe() error
+}
+
+// PaperExchange takes tickers from a live feed and fills orders on the simulator
+// against the current bid/ask, nothing is sent to the real exchange
+type PaperExchange struct {
+	*Exchange
+	feed   Feed
+	muFeed sync.Mutex
+	done   chan struct{} // closed when the subscription is replaced or closed
+}
+
+func NewPaper(feed Feed) *PaperExchange {
+	return &PaperExchange{Exchange: New(), feed: feed}
+}
+
+func (p *PaperExchange) Subscribe(instruments ...string) (<-chan domain.Ticker, error) {
+	in, err := p.feed.Subscribe(instruments...)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	p.muFeed.Lock()
+	if p.done != nil {
+		close(p.done)
+	}
+	p.done = done
+	p.muFeed.Unlock()
+	out := make(chan domain.Ticker)
+	go func() {
+		defer close(out)
+		for {
+			var ticker domain.Ticker
+			var ok bool
+			select {
+			case ticker, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+			p.SetQuote(ticker)
+			select {
+			case out <- ticker:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (p *PaperExchange) Unsubscribe() error {
+	p.muFeed.Lock()
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+	p.muFeed.Unlock()
+	return p.feed.Unsubscribe()
+}
@@ -1,14 +1,19 @@
 package telegramapi
 
 import (
+	"context"
 	"errors"
 	"sync"
 	// not-std
+	"bot/metrics"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	log "github.com/sirupsen/logrus"
 )
 
-var JobQueueIsFull = errors.New("notifier's job queue is full")
+var (
+	JobQueueIsFull = errors.New("notifier's job queue is full")
+	ErrStopped     = errors.New("notifier is stopped")
+)
 
 const DefaultJobQueueSize = 10
 
@@ -16,8 +21,11 @@ type TgBot struct {
 	chatsMu      sync.Mutex
 	chats        map[int64]*tgbotapi.Chat
 	bot          *tgbotapi.BotAPI
+	queueMu      sync.Mutex
 	jobQueue     chan string
+	drained      chan struct{} // closed when the stopped queue is sent
 	jobQueueSize int
+	tag          string
 }
 
 func New(token string, jobQueueSize int) (*TgBot, error) {
@@ -67,24 +75,50 @@ func (t *TgBot) Start() error {
 		}
 	}()
 	// job queue: listen and send messages
-	t.jobQueue = make(chan string, t.jobQueueSize)
+	jobQueue := make(chan string, t.jobQueueSize)
+	drained := make(chan struct{})
+	t.queueMu.Lock()
+	t.jobQueue, t.drained = jobQueue, drained
+	t.queueMu.Unlock()
 	go func() {
-		for message := range t.jobQueue {
-			err := t.sendMessage(message)
-			if err != nil {
+		defer close(drained)
+		for message := range jobQueue {
+			if err := t.sendMessage(message); err != nil {
 				log.Error(err)
-				return
 			}
 		}
 	}()
 	return err
 }
 
+// Stop stops receiving updates and new notifications,
+// queued notifications are still sent, see Flush
 func (t *TgBot) Stop() {
-	close(t.jobQueue)
+	t.queueMu.Lock()
+	if t.jobQueue != nil {
+		close(t.jobQueue)
+		t.jobQueue = nil
+	}
+	t.queueMu.Unlock()
 	t.bot.StopReceivingUpdates()
 }
 
+// Flush waits until the notifications queued before Stop are sent
+func (t *TgBot) Flush(ctx context.Context) error {
+	t.queueMu.Lock()
+	drained := t.drained
+	t.queueMu.Unlock()
+	if drained == nil {
+		return nil
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (t *TgBot) addChat(chat *tgbotapi.Chat) {
 	t.chatsMu.Lock()
 	defer t.chatsMu.Unlock()
@@ -115,11 +149,25 @@ func (t *TgBot) sendMessage(text string) error {
 	return nil
 }
 
+// SetTag sets a tag prepended to every notification, e.g. PAPER
+func (t *TgBot) SetTag(tag string) {
+	t.tag = tag
+}
+
 func (t *TgBot) Notify(text string) error {
+	if t.tag != "" {
+		text = "*[" + t.tag + "]* " + text
+	}
+	t.queueMu.Lock()
+	defer t.queueMu.Unlock()
+	if t.jobQueue == nil {
+		return ErrStopped
+	}
 	select {
 	case t.jobQueue <- text:
 		return nil
 	default:
+		metrics.NotificationDrops.Inc()
 		return JobQueueIsFull
 	}
 }
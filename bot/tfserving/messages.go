@@ -0,0 +1,274 @@
+// Package tfserving speaks the TensorFlow Serving PredictionService gRPC protocol.
+// Only the messages of the Predict call are implemented, they are encoded with
+// protowire by hand to avoid generating the whole TensorFlow proto tree.
+package tfserving
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	// not-std
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Data types of tensors, tensorflow/core/framework/types.proto
+const (
+	DTFloat  = 1
+	DTDouble = 2
+)
+
+var ErrUnsupportedTensor = errors.New("unsupported tensor")
+
+// ModelSpec selects the model, tensorflow_serving/apis/model.proto
+type ModelSpec struct {
+	Name          string
+	Version       int64 // latest if 0
+	SignatureName string
+}
+
+// Tensor is a float tensor, tensorflow/core/framework/tensor.proto
+type Tensor struct {
+	Shape  []int64
+	Values []float32
+}
+
+// PredictRequest is tensorflow_serving/apis/predict.proto PredictRequest
+type PredictRequest struct {
+	ModelSpec ModelSpec
+	Inputs    map[string]Tensor
+}
+
+// PredictResponse is tensorflow_serving/apis/predict.proto PredictResponse
+type PredictResponse struct {
+	ModelSpec ModelSpec
+	Outputs   map[string]Tensor
+}
+
+// Marshal encodes the request: model_spec = 1, inputs = 2
+func (r *PredictRequest) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, r.ModelSpec.marshal())
+	b = appendTensors(b, 2, r.Inputs)
+	return b
+}
+
+// Unmarshal decodes the request
+func (r *PredictRequest) Unmarshal(data []byte) error {
+	r.Inputs = make(map[string]Tensor)
+	return walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return r.ModelSpec.unmarshal(value)
+		case num == 2 && typ == protowire.BytesType:
+			return unmarshalEntry(value, r.Inputs)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the response: outputs = 1, model_spec = 2
+func (r *PredictResponse) Marshal() []byte {
+	var b []byte
+	b = appendTensors(b, 1, r.Outputs)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, r.ModelSpec.marshal())
+	return b
+}
+
+// Unmarshal decodes the response
+func (r *PredictResponse) Unmarshal(data []byte) error {
+	r.Outputs = make(map[string]Tensor)
+	return walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return unmarshalEntry(value, r.Outputs)
+		case num == 2 && typ == protowire.BytesType:
+			return r.ModelSpec.unmarshal(value)
+		}
+		return nil
+	})
+}
+
+// marshal encodes name = 1, version = 2 (Int64Value), signature_name = 3
+func (s ModelSpec) marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, s.Name)
+	if s.Version != 0 {
+		var version []byte
+		version = protowire.AppendTag(version, 1, protowire.VarintType)
+		version = protowire.AppendVarint(version, uint64(s.Version))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, version)
+	}
+	if s.SignatureName != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, s.SignatureName)
+	}
+	return b
+}
+
+func (s *ModelSpec) unmarshal(data []byte) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			s.Name = string(value)
+		case num == 2 && typ == protowire.BytesType:
+			return walk(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if num == 1 && typ == protowire.VarintType {
+					v, _ := protowire.ConsumeVarint(value)
+					s.Version = int64(v)
+				}
+				return nil
+			})
+		case num == 3 && typ == protowire.BytesType:
+			s.SignatureName = string(value)
+		}
+		return nil
+	})
+}
+
+// marshal encodes dtype = 1, tensor_shape = 2 with dim = 2 {size = 1}, float_val = 5 (packed)
+func (t Tensor) marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, DTFloat)
+	var shape []byte
+	for _, size := range t.Shape {
+		var dim []byte
+		dim = protowire.AppendTag(dim, 1, protowire.VarintType)
+		dim = protowire.AppendVarint(dim, uint64(size))
+		shape = protowire.AppendTag(shape, 2, protowire.BytesType)
+		shape = protowire.AppendBytes(shape, dim)
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, shape)
+	values := make([]byte, 0, 4*len(t.Values))
+	for _, v := range t.Values {
+		values = protowire.AppendFixed32(values, math.Float32bits(v))
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, values)
+	return b
+}
+
+// unmarshal decodes float and double tensors from float_val, double_val or tensor_content
+func (t *Tensor) unmarshal(data []byte) error {
+	dtype := uint64(DTFloat)
+	var content []byte
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			dtype, _ = protowire.ConsumeVarint(value)
+		case num == 2 && typ == protowire.BytesType:
+			return walk(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if num != 2 || typ != protowire.BytesType {
+					return nil
+				}
+				return walk(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					if num == 1 && typ == protowire.VarintType {
+						size, _ := protowire.ConsumeVarint(value)
+						t.Shape = append(t.Shape, int64(size))
+					}
+					return nil
+				})
+			})
+		case num == 4 && typ == protowire.BytesType:
+			content = value
+		case num == 5 && typ == protowire.BytesType: // packed
+			for i := 0; i+4 <= len(value); i += 4 {
+				t.Values = append(t.Values, math.Float32frombits(binary.LittleEndian.Uint32(value[i:])))
+			}
+		case num == 5 && typ == protowire.Fixed32Type:
+			v, _ := protowire.ConsumeFixed32(value)
+			t.Values = append(t.Values, math.Float32frombits(v))
+		case num == 6 && typ == protowire.BytesType:
+			for i := 0; i+8 <= len(value); i += 8 {
+				t.Values = append(t.Values, float32(math.Float64frombits(binary.LittleEndian.Uint64(value[i:]))))
+			}
+		case num == 6 && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(value)
+			t.Values = append(t.Values, float32(math.Float64frombits(v)))
+		}
+		return nil
+	})
+	if err != nil || content == nil {
+		return err
+	}
+	switch dtype {
+	case DTFloat:
+		for i := 0; i+4 <= len(content); i += 4 {
+			t.Values = append(t.Values, math.Float32frombits(binary.LittleEndian.Uint32(content[i:])))
+		}
+	case DTDouble:
+		for i := 0; i+8 <= len(content); i += 8 {
+			t.Values = append(t.Values, float32(math.Float64frombits(binary.LittleEndian.Uint64(content[i:]))))
+		}
+	default:
+		return fmt.Errorf("%w: dtype %d", ErrUnsupportedTensor, dtype)
+	}
+	return nil
+}
+
+// appendTensors appends the map<string, TensorProto> field
+func appendTensors(b []byte, num protowire.Number, tensors map[string]Tensor) []byte {
+	for name, tensor := range tensors {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, tensor.marshal())
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func unmarshalEntry(data []byte, tensors map[string]Tensor) error {
+	var name string
+	var tensor Tensor
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			name = string(value)
+		case num == 2 && typ == protowire.BytesType:
+			return tensor.unmarshal(value)
+		}
+		return nil
+	})
+	tensors[name] = tensor
+	return err
+}
+
+// walk calls fn for every field of the message with the raw value of the field:
+// the varint or fixed bytes or the content of the length-delimited field
+func walk(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			value, n = v, m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = data[:n]
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package tfserving
+
+import (
+	"context"
+	"fmt"
+	// not-std
+	"google.golang.org/grpc"
+)
+
+const (
+	ServiceName   = "tensorflow.serving.PredictionService"
+	predictMethod = "/" + ServiceName + "/Predict"
+)
+
+// message is encoded by Codec
+type message interface {
+	Marshal() []byte
+	Unmarshal(data []byte) error
+}
+
+// Codec encodes the messages of the package, it replaces the default proto codec
+// of the connection, so the messages don't need to be generated proto types
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("tfserving: can't marshal %T", v)
+	}
+	return m.Marshal(), nil
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("tfserving: can't unmarshal %T", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+// Client calls PredictionService over the connection
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial opens the connection, it's reused by all calls and reconnects by itself
+func Dial(address string) (*Client, error) {
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{})))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn}, nil
+}
+
+func (c *Client) Predict(ctx context.Context, req *PredictRequest) (*PredictResponse, error) {
+	resp := &PredictResponse{}
+	if err := c.conn.Invoke(ctx, predictMethod, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// PredictionServer is implemented by servers of the Predict call, e.g. the fake one of modelsim
+type PredictionServer interface {
+	Predict(ctx context.Context, req *PredictRequest) (*PredictResponse, error)
+}
+
+// NewServer returns a gRPC server of PredictionService with the codec of the package
+func NewServer(srv PredictionServer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(append(opts, grpc.ForceServerCodec(Codec{}))...)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*PredictionServer)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Predict",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &PredictRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(PredictionServer).Predict(ctx, req)
+			},
+		}},
+	}, srv)
+	return server
+}